@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminAuth — учётные данные для изменяющих запросов: токен Bearer,
+// пара логин — пароль для Basic и ключи для заголовка X-API-Key.
+// Способ с пустыми значениями выключен; подходит любой включённый.
+type adminAuth struct {
+	token      string
+	user, pass string
+	keys       []string
+}
+
+// enabled сообщает, включён ли хотя бы один способ проверки.
+func (a adminAuth) enabled() bool {
+	return a.token != "" || a.basic() || len(a.keys) > 0
+}
+
+// basic сообщает, заданы ли логин и пароль для Basic.
+func (a adminAuth) basic() bool {
+	return a.user != "" && a.pass != ""
+}
+
+// allow проверяет заголовки X-API-Key и Authorization запроса req. Значения
+// сравниваются за постоянное время, чтобы не выдать их по задержке ответа.
+func (a adminAuth) allow(req *http.Request) bool {
+	if key := req.Header.Get("X-API-Key"); key != "" && len(a.keys) > 0 {
+		// сверяются все ключи, чтобы время не зависело от того, какой подошёл
+		match := 0
+		for _, k := range a.keys {
+			match |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+		}
+		return match == 1
+	}
+	if a.token != "" {
+		if got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			return subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) == 1
+		}
+	}
+	if a.basic() {
+		if user, pass, ok := req.BasicAuth(); ok {
+			// оба сравнения выполняются всегда, даже при неверном логине
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.user))
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(a.pass))
+			return userOK&passOK == 1
+		}
+	}
+	return false
+}
+
+// deny отвечает 401 unauthorized с заголовками WWW-Authenticate
+// для каждого включённого способа проверки; у X-API-Key стандартной
+// схемы нет, поэтому для него указывается своя, APIKey.
+func (a adminAuth) deny(w http.ResponseWriter, req *http.Request) {
+	if a.basic() {
+		w.Header().Add("WWW-Authenticate", `Basic realm="cafe admin", charset="UTF-8"`)
+	}
+	if a.token != "" {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="cafe admin"`)
+	}
+	if len(a.keys) > 0 {
+		w.Header().Add("WWW-Authenticate", `APIKey realm="cafe admin", header="X-API-Key"`)
+	}
+	writeError(w, req, http.StatusUnauthorized, "unauthorized")
+}
+
+// adminHandler пропускает к next изменяющие запросы, например POST
+// и DELETE, только с верными учётными данными auth, а GET, HEAD
+// и OPTIONS — без проверки. Если auth не включён, проверки нет.
+func adminHandler(next http.Handler, auth adminAuth) http.Handler {
+	if !auth.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !auth.allow(req) {
+				auth.deny(w, req)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminUser = "admin"
+	cfg.AdminPass = "пароль"
+	mux := NewServer(NewMemoryStore(map[string][]string{"kazan": {"Чак-чак"}}), cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	requests := []struct {
+		method string
+		target string
+		user   string
+		pass   string
+		status int
+	}{
+		{"POST", "/v1/cafe?city=kazan", "", "", http.StatusUnauthorized},
+		{"POST", "/v1/cafe?city=kazan", "admin", "wrong", http.StatusUnauthorized},
+		{"POST", "/v1/cafe?city=kazan", "root", "пароль", http.StatusUnauthorized},
+		{"POST", "/v1/cafe?city=kazan", "admin", "пароль", http.StatusCreated},
+		{"DELETE", "/cafe?city=kazan&name=Чак-чак", "", "", http.StatusUnauthorized},
+		{"DELETE", "/cafe?city=kazan&name=Чак-чак", "admin", "пароль", http.StatusNoContent},
+		{"DELETE", "/stats", "admin", "", http.StatusUnauthorized},
+		{"DELETE", "/stats", "admin", "пароль", http.StatusNoContent},
+		// чтение остаётся открытым
+		{"GET", "/v1/cafe?city=kazan", "", "", http.StatusOK},
+		{"HEAD", "/v1/cafe?city=kazan", "", "", http.StatusOK},
+		{"GET", "/stats", "", "", http.StatusOK},
+		{"POST", "/v1/cafe/batch", "", "", http.StatusBadRequest},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, v.target, strings.NewReader(`{"name":"Эчпочмак"}`))
+		if v.user != "" {
+			req.SetBasicAuth(v.user, v.pass)
+		}
+		mux.ServeHTTP(response, req)
+
+		name := v.method + " " + v.target + " " + v.user
+		assert.Equal(t, v.status, response.Code, name)
+		if v.status == http.StatusUnauthorized {
+			assert.Equal(t, `Basic realm="cafe admin", charset="UTF-8"`, response.Header().Get("WWW-Authenticate"), name)
+			assert.Equal(t, "unauthorized", strings.TrimSpace(response.Body.String()), name)
+		}
+	}
+
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, httptest.NewRequest("GET", "/v1/cafe?city=kazan", nil))
+	assert.Equal(t, "Эчпочмак", response.Body.String())
+}
+
+func TestAdminAPIKey(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminUser = "admin"
+	cfg.AdminPass = "пароль"
+	cfg.APIKeys = []string{"key-1", "key-2"}
+	mux := NewServer(NewMemoryStore(map[string][]string{"kazan": {"Чак-чак"}}), cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	requests := []struct {
+		key    string
+		basic  bool
+		status int
+	}{
+		{"", false, http.StatusUnauthorized},
+		{"key-3", false, http.StatusUnauthorized},
+		{"key-", false, http.StatusUnauthorized},
+		// неверный ключ не исправляется верным паролем
+		{"wrong", true, http.StatusUnauthorized},
+		{"key-1", false, http.StatusNoContent},
+		{"key-2", false, http.StatusNoContent},
+		{"", true, http.StatusNoContent},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/stats", nil)
+		if v.key != "" {
+			req.Header.Set("X-API-Key", v.key)
+		}
+		if v.basic {
+			req.SetBasicAuth("admin", "пароль")
+		}
+		mux.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.key)
+		if v.status == http.StatusUnauthorized {
+			assert.Contains(t, response.Header().Values("WWW-Authenticate"), `APIKey realm="cafe admin", header="X-API-Key"`, v.key)
+		}
+	}
+
+	// одних ключей достаточно, чтобы закрыть изменяющие запросы
+	cfg = DefaultConfig()
+	cfg.APIKeys = []string{"key-1"}
+	mux = NewServer(NewMemoryStore(map[string][]string{"kazan": {"Чак-чак"}}), cfg, slog.New(slog.DiscardHandler), nil).mux()
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, httptest.NewRequest("DELETE", "/cafe?city=kazan&name=Чак-чак", nil))
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.Equal(t, []string{`APIKey realm="cafe admin", header="X-API-Key"`}, response.Header().Values("WWW-Authenticate"))
+}
+
+func TestAdminAuthReload(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DataPaths = writeDataFile(t, `{"kazan":["Чак-чак"]}`)
+	cfg.ReloadToken = "secret"
+	cfg.AdminUser = "admin"
+	cfg.AdminPass = "пароль"
+	mux := NewServer(NewMemoryStore(nil), cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	requests := []struct {
+		auth   func(req *http.Request)
+		status int
+	}{
+		{func(req *http.Request) {}, http.StatusUnauthorized},
+		{func(req *http.Request) { req.SetBasicAuth("admin", "secret") }, http.StatusUnauthorized},
+		{func(req *http.Request) { req.Header.Set("Authorization", "Bearer пароль") }, http.StatusUnauthorized},
+		{func(req *http.Request) { req.SetBasicAuth("admin", "пароль") }, http.StatusOK},
+		{func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+	}
+	for i, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/reload", nil)
+		v.auth(req)
+		mux.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, i)
+		if v.status == http.StatusUnauthorized {
+			assert.Equal(t, []string{`Basic realm="cafe admin", charset="UTF-8"`, `Bearer realm="cafe admin"`}, response.Header().Values("WWW-Authenticate"), i)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxBatchSize — наибольшее число запросов в одном пакете.
+const maxBatchSize = 50
+
+// batchQuery — один запрос пакета, как параметры GET /cafe.
+type batchQuery struct {
+	City   string `json:"city"`
+	Search string `json:"search,omitempty"`
+	Count  *int   `json:"count,omitempty"`
+}
+
+// batchResult — ответ на один запрос пакета: найденные кафе
+// или текст ошибки, если запрос не удался.
+type batchResult struct {
+	City  string          `json:"city"`
+	Cafes json.RawMessage `json:"cafes,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// newBatchHandler обрабатывает POST /cafe/batch: тело — JSON-массив
+// запросов, ответ — массив результатов в том же порядке. Каждый запрос
+// выполняется обработчиком list как GET /cafe, поэтому ошибка одного
+// запроса, например неизвестный город, не прерывает остальные.
+func newBatchHandler(list http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, req, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var queries []batchQuery
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&queries); err != nil {
+			writeBodyError(w, req, err, "invalid body")
+			return
+		}
+		if queries == nil {
+			writeError(w, req, http.StatusBadRequest, "invalid body")
+			return
+		}
+		if len(queries) > maxBatchSize {
+			writeError(w, req, http.StatusBadRequest, "batch too large")
+			return
+		}
+
+		results := make([]batchResult, 0, len(queries))
+		for _, q := range queries {
+			if req.Context().Err() != nil {
+				return
+			}
+			results = append(results, runBatchQuery(list, req, q))
+		}
+		writeJSON(w, req, results)
+	}
+}
+
+// runBatchQuery выполняет запрос q пакета req через обработчик list.
+func runBatchQuery(list http.Handler, req *http.Request, q batchQuery) batchResult {
+	params := url.Values{"city": {q.City}, "format": {"json"}}
+	if q.Search != "" {
+		params.Set("search", q.Search)
+	}
+	if q.Count != nil {
+		params.Set("count", strconv.Itoa(*q.Count))
+	}
+	result := batchResult{City: normalizeCity(q.City)}
+	sub, err := http.NewRequestWithContext(req.Context(), http.MethodGet, "/cafe?"+params.Encode(), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sub.Header.Set("Accept", "application/json")
+	sub.Header.Set("Accept-Language", req.Header.Get("Accept-Language"))
+
+	rec := &headerRecorder{header: http.Header{}}
+	list.ServeHTTP(rec, sub)
+	if rec.status == 0 || rec.status == http.StatusOK {
+		if city := rec.header.Get("X-Cafe-City"); city != "" {
+			result.City = city
+		}
+		result.Cafes = bytes.TrimSpace(rec.body.Bytes())
+		return result
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(rec.body.Bytes(), &body) != nil || body.Error == "" {
+		body.Error = http.StatusText(rec.status)
+	}
+	result.Error = body.Error
+	return result
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCafeBatch(t *testing.T) {
+	handler := newMux(NewMemoryStore(cafeList))
+
+	requests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		want   string
+	}{
+		{"ok", "POST", `[{"city":"moscow","search":"кофе","count":1},{"city":"Tula"}]`, http.StatusOK,
+			`[{"city":"moscow","cafes":[{"name":"Мир кофе"}]},` +
+				`{"city":"tula","cafes":[{"name":"Пир и мир"},{"name":"Красиво есть не запретишь"},{"name":"Поздний завтрак"}]}]`},
+		{"partial error", "POST", `[{"city":"omsk"},{"city":"tula","count":-5},{"city":"tula","search":"мир"}]`, http.StatusOK,
+			`[{"city":"omsk","error":"unknown city"},{"city":"tula","error":"incorrect count"},{"city":"tula","cafes":[{"name":"Пир и мир"}]}]`},
+		{"empty", "POST", `[]`, http.StatusOK, `[]`},
+		{"malformed", "POST", `[{"city":`, http.StatusBadRequest, "invalid body"},
+		{"not array", "POST", `{"city":"moscow"}`, http.StatusBadRequest, "invalid body"},
+		{"null", "POST", `null`, http.StatusBadRequest, "invalid body"},
+		{"unknown field", "POST", `[{"city":"moscow","limit":1}]`, http.StatusBadRequest, "invalid body"},
+		{"too large", "POST", "[" + strings.Repeat(`{"city":"moscow"},`, maxBatchSize) + `{"city":"moscow"}]`, http.StatusBadRequest, "batch too large"},
+		{"method", "GET", "", http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, v := range requests {
+		t.Run(v.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest(v.method, "/v1/cafe/batch", strings.NewReader(v.body))
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, v.status, response.Code)
+			assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// cachedResponse — готовый ответ: заголовки, выставленные при его
+// формировании, и тело.
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+type cacheEntry struct {
+	key  string
+	resp cachedResponse
+}
+
+// responseCache — ограниченный по размеру LRU-кеш готовых ответов,
+// безопасный для конкурентного доступа. Кеш целиком сбрасывается,
+// когда меняется версия данных хранилища. Нулевой *responseCache
+// ничего не кеширует.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	version uint64
+	order   *list.List // от недавно использованных к давним
+	items   map[string]*list.Element
+	hits    int
+	misses  int
+}
+
+// newResponseCache создаёт кеш на size ответов; при size <= 0 кеш выключен.
+func newResponseCache(size int) *responseCache {
+	if size <= 0 {
+		return nil
+	}
+	return &responseCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// versionedStore реализуют хранилища, версия данных которых
+// меняется при каждом изменении.
+type versionedStore interface {
+	version() uint64
+}
+
+func (c *responseCache) get(key string, version uint64) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion(version)
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return cachedResponse{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).resp, true
+}
+
+func (c *responseCache) put(key string, version uint64, resp cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// ответ построен по устаревшим данным
+	if version < c.version {
+		return
+	}
+	c.checkVersion(version)
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).resp = resp
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, resp: resp})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// checkVersion сбрасывает кеш, если данные хранилища изменились.
+// Вызывается под c.mu.
+func (c *responseCache) checkVersion(version uint64) {
+	if version == c.version {
+		return
+	}
+	c.version = version
+	c.order.Init()
+	clear(c.items)
+}
+
+// serve отвечает на запрос из кеша по ключу key, а при промахе
+// формирует ответ функцией render и запоминает его, если он успешный.
+// Хранилища без версии данных не кешируются.
+func (c *responseCache) serve(w http.ResponseWriter, store CafeStore, key string, render func(http.ResponseWriter)) {
+	vs, ok := store.(versionedStore)
+	if c == nil || !ok {
+		render(w)
+		return
+	}
+	version := vs.version()
+	if resp, ok := c.get(key, version); ok {
+		h := w.Header()
+		for name, values := range resp.header {
+			h[name] = slices.Clone(values)
+		}
+		w.Write(resp.body)
+		return
+	}
+
+	// запоминаются только заголовки, выставленные самим render
+	before := w.Header().Clone()
+	rec := &bufferRecorder{ResponseWriter: w}
+	render(rec)
+	// render ничего не записал, например из-за отмены запроса,
+	// такой ответ не кешируется
+	if rec.status == 0 {
+		return
+	}
+	if rec.status == http.StatusOK {
+		header := make(http.Header)
+		for name, values := range w.Header() {
+			if !slices.Equal(before[name], values) {
+				header[name] = slices.Clone(values)
+			}
+		}
+		c.put(key, version, cachedResponse{header: header, body: slices.Clone(rec.body.Bytes())})
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCafeCache(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	cache := newResponseCache(2)
+	handler := listCafeHandler(store, cache, DefaultConfig())
+
+	get := func(target string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", target, nil))
+		return response
+	}
+
+	first := get("/cafe?city=moscow&search=кофе&count=2")
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, 0, cache.hits)
+
+	// тот же запрос, записанный иначе, отдаётся из кеша
+	second := get("/cafe?count=2&search=КОФЕ&city=Moscow")
+	assert.Equal(t, 1, cache.hits)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, first.Header(), second.Header())
+
+	// ошибки не кешируются
+	get("/cafe?city=omsk")
+	get("/cafe?city=omsk")
+	assert.Equal(t, 1, cache.hits)
+
+	// изменение данных сбрасывает кеш
+	require.NoError(t, store.Add("moscow", "Кофе Хауз"))
+	third := get("/cafe?city=moscow&search=кофе&count=-1")
+	assert.Equal(t, 1, cache.hits)
+	assert.Contains(t, third.Body.String(), "Кофе Хауз")
+
+	store.Replace(map[string][]string{"moscow": {"Кофемания"}})
+	assert.Equal(t, "Кофемания", get("/cafe?city=moscow&search=кофе&count=-1").Body.String())
+	assert.Equal(t, 1, cache.hits)
+}
+
+func TestCafeCacheKey(t *testing.T) {
+	rating := func(v float64) *float64 { return &v }
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{
+		"moscow": {
+			{Name: "Мир кофе", Rating: rating(4.5), Tags: []string{"coffee"}, Hours: &Hours{Open: 8 * 60, Close: 22 * 60}},
+			{Name: "Сладкоежка", Rating: rating(3.9), Tags: []string{"breakfast"}, Featured: true},
+			{Name: "Кофейня", Hours: &Hours{Open: 20 * 60, Close: 2 * 60}},
+			{Name: "Ёлка и кофе", Rating: rating(4.1), Tags: []string{"coffee", "breakfast"}},
+		},
+		"tula": {{Name: "Пир и мир"}},
+	})
+	cfg := DefaultConfig()
+	cfg.JSONP = true
+	cfg.AllowRegex = true
+
+	saved := timeNow
+	timeNow = func() time.Time { return time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { timeNow = saved })
+
+	// для каждого параметра — два запроса с разными ответами; второй
+	// не должен получить из кеша ответ на первый
+	requests := map[string][2]string{
+		"at":                  {"at=09:00", "at=23:00"},
+		"callback":            {"format=json&callback=a", "format=json&callback=b"},
+		"city":                {"city=moscow", "city=tula"},
+		"count":               {"count=1", "count=2"},
+		"delimiter":           {"delimiter=comma", "delimiter=semicolon"},
+		"exclude":             {"", "exclude=кофе"},
+		"featuredOnly":        {"", "featuredOnly=true"},
+		"fields":              {"format=json&fields=name", "format=json&fields=name,rating"},
+		"fold":                {"search=елка", "search=елка&fold=true"},
+		"format":              {"", "format=json"},
+		"fuzzy":               {"search=кофа", "search=кофа&fuzzy=true"},
+		"includeUnknownHours": {"at=09:00", "at=09:00&includeUnknownHours=true"},
+		"match":               {"search=мир,кофе", "search=мир,кофе&match=all"},
+		"maxDistance":         {"search=слодкоешка&fuzzy=true&maxDistance=0", "search=слодкоешка&fuzzy=true&maxDistance=2"},
+		"minRating":           {"", "minRating=4"},
+		"minResults":          {"search=кофа", "search=кофа&minResults=1"},
+		"mode":                {"search=кофе", "search=кофе&mode=prefix"},
+		"offset":              {"", "offset=1"},
+		"open":                {"", "open=now"},
+		"pretty":              {"format=json", "format=json&pretty=true"},
+		"regex":               {"search=^мир", "search=^мир&regex=true"},
+		"search":              {"search=кофе", "search=мир"},
+		"sort":                {"sort=name", "sort=rating"},
+		"tag":                 {"tag=coffee", "tag=breakfast"},
+		"translit":            {"search=mir", "search=mir&translit=true"},
+		"wholeWord":           {"search=кофе", "search=кофе&wholeWord=true"},
+	}
+	// новый параметр без строки в таблице тоже роняет тест
+	assert.ElementsMatch(t, cafeParams, slices.Collect(maps.Keys(requests)))
+
+	get := func(handler http.Handler, query string) *httptest.ResponseRecorder {
+		values, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		for key, value := range map[string]string{"city": "moscow", "count": "-1"} {
+			if !values.Has(key) {
+				values.Set(key, value)
+			}
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?"+values.Encode(), nil))
+		return response
+	}
+	uncached := listCafeHandler(store, nil, cfg)
+	for param, v := range requests {
+		first, second := get(uncached, v[0]), get(uncached, v[1])
+		require.Equal(t, http.StatusOK, second.Code, param)
+		require.NotEqual(t, first.Body.String(), second.Body.String(), param)
+
+		cache := newResponseCache(10)
+		handler := listCafeHandler(store, cache, cfg)
+		get(handler, v[0])
+		response := get(handler, v[1])
+		assert.Equal(t, 0, cache.hits, param)
+		assert.Equal(t, second.Body.String(), response.Body.String(), param)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := newResponseCache(2)
+	resp := cachedResponse{body: []byte("ok")}
+	cache.put("a", 0, resp)
+	cache.put("b", 0, resp)
+	cache.get("a", 0)
+	// вытесняется давно не использованный b
+	cache.put("c", 0, resp)
+
+	_, ok := cache.get("a", 0)
+	assert.True(t, ok)
+	_, ok = cache.get("b", 0)
+	assert.False(t, ok)
+	_, ok = cache.get("c", 0)
+	assert.True(t, ok)
+
+	// ответ по устаревшим данным не запоминается
+	cache.get("a", 1)
+	cache.put("d", 0, resp)
+	_, ok = cache.get("d", 1)
+	assert.False(t, ok)
+
+	assert.Nil(t, newResponseCache(0))
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config — настройки сервера.
+type Config struct {
+	// Addr — адрес, на котором сервер принимает запросы.
+	Addr string
+	// StrictParams включает отказ на неизвестные параметры запроса.
+	StrictParams bool
+	// MaxCount — наибольшее значение count.
+	MaxCount int
+	// DefaultCount — сколько кафе вернуть, если count не указан;
+	// 0 означает все. Значение больше MaxCount урезается до MaxCount.
+	DefaultCount int
+	// LogFormat — формат журнала: text или json.
+	LogFormat string
+	// LogLevel — наименьший уровень записей журнала; по умолчанию info.
+	LogLevel slog.Level
+	// CORSOrigin — источник, которому разрешены запросы из браузера,
+	// например *. Если не задан, CORS выключен.
+	CORSOrigin string
+	// RateLimit — допустимое число запросов в секунду с одного IP;
+	// 0 отключает ограничение.
+	RateLimit float64
+	// RateBurst — сколько запросов подряд можно сделать сверх RateLimit.
+	RateBurst int
+	// CacheSize — сколько ответов /cafe хранить в кеше; 0 отключает кеш.
+	CacheSize int
+	// CacheMaxAge — сколько секунд клиенты и CDN могут кешировать
+	// успешный ответ GET /cafe.
+	CacheMaxAge int
+	// RequestTimeout — наибольшее время обработки запроса /cafe;
+	// 0 отключает ограничение.
+	RequestTimeout time.Duration
+	// JSONP разрешает оборачивать JSON-ответ /cafe в вызов функции
+	// из параметра callback.
+	JSONP bool
+	// MaxSearchLen — наибольшая длина search в рунах; 0 отключает проверку.
+	MaxSearchLen int
+	// MaxBodySize — наибольший размер тела POST /cafe, /cafe/batch
+	// и /reload в байтах; 0 отключает проверку.
+	MaxBodySize int64
+	// AllowRegex разрешает поиск по регулярному выражению через regex=true.
+	AllowRegex bool
+	// TLSCert и TLSKey — пути к сертификату и ключу в PEM. Если заданы
+	// оба, сервер принимает запросы по HTTPS.
+	TLSCert string
+	TLSKey  string
+	// DataPaths — файлы или каталоги с данными через запятую, как
+	// в loadData. Если не заданы, используются встроенные данные.
+	DataPaths string
+	// ReloadToken — токен Bearer для POST /reload. Если не задан ни он,
+	// ни учётные данные администратора, перечитать данные можно только
+	// по SIGHUP.
+	ReloadToken string
+	// AdminUser и AdminPass — логин и пароль Basic для изменяющих
+	// запросов: POST и DELETE /cafe, DELETE /stats и POST /reload.
+	// Если не заданы ни они, ни APIKeys, такие запросы не проверяются.
+	AdminUser string
+	AdminPass string
+	// APIKeys — ключи, с любым из которых в заголовке X-API-Key
+	// изменяющий запрос пропускается так же, как с AdminUser и AdminPass.
+	APIKeys []string
+	// RandomSeed, если задан, — начальное значение общего генератора
+	// случайных чисел /cafe/random для запросов без seed: последовательность
+	// ответов после запуска повторяется. Параметр seed запроса важнее.
+	RandomSeed *int64
+	// Debug включает отладочный маршрут /debug/config.
+	Debug bool
+}
+
+// DefaultConfig возвращает настройки по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		Addr:           ":8080",
+		MaxCount:       1000,
+		DefaultCount:   25,
+		RateLimit:      10,
+		RateBurst:      20,
+		CacheSize:      128,
+		CacheMaxAge:    60,
+		RequestTimeout: 5 * time.Second,
+		MaxSearchLen:   100,
+		MaxBodySize:    64 << 10,
+	}
+}
+
+// configFromEnv возвращает настройки по умолчанию, переопределённые
+// переменными окружения ADDR, CAFE_STRICT_PARAMS=1, CAFE_MAX_COUNT,
+// CAFE_DEFAULT_COUNT, LOG_FORMAT, LOG_LEVEL, CORS_ORIGIN, RATE_LIMIT_RPS, RATE_LIMIT_BURST, CAFE_CACHE_SIZE,
+// CAFE_CACHE_MAX_AGE (по умолчанию 0, если данные можно перечитать),
+// REQUEST_TIMEOUT, CAFE_JSONP=1, CAFE_MAX_SEARCH_LEN, CAFE_MAX_BODY_SIZE, CAFE_ALLOW_REGEX=1,
+// TLS_CERT, TLS_KEY, CAFE_DATA, RELOAD_TOKEN, ADMIN_USER, ADMIN_PASS,
+// API_KEYS, CAFE_RANDOM_SEED и DEBUG=1.
+func configFromEnv() Config {
+	def := DefaultConfig()
+	// перечитываемые данные клиенты по умолчанию не кешируют,
+	// чтобы сразу видеть изменения
+	maxAge := def.CacheMaxAge
+	if os.Getenv("CAFE_DATA") != "" {
+		maxAge = 0
+	}
+	return Config{
+		Addr:           envString("ADDR", def.Addr),
+		StrictParams:   os.Getenv("CAFE_STRICT_PARAMS") == "1",
+		MaxCount:       envPositiveInt("CAFE_MAX_COUNT", def.MaxCount),
+		DefaultCount:   envInt("CAFE_DEFAULT_COUNT", def.DefaultCount),
+		LogFormat:      os.Getenv("LOG_FORMAT"),
+		LogLevel:       envLevel("LOG_LEVEL", def.LogLevel),
+		CORSOrigin:     os.Getenv("CORS_ORIGIN"),
+		RateLimit:      envFloat("RATE_LIMIT_RPS", def.RateLimit),
+		RateBurst:      envInt("RATE_LIMIT_BURST", def.RateBurst),
+		CacheSize:      envInt("CAFE_CACHE_SIZE", def.CacheSize),
+		CacheMaxAge:    envInt("CAFE_CACHE_MAX_AGE", maxAge),
+		RequestTimeout: envDuration("REQUEST_TIMEOUT", def.RequestTimeout),
+		JSONP:          os.Getenv("CAFE_JSONP") == "1",
+		MaxSearchLen:   envInt("CAFE_MAX_SEARCH_LEN", def.MaxSearchLen),
+		MaxBodySize:    int64(envInt("CAFE_MAX_BODY_SIZE", int(def.MaxBodySize))),
+		AllowRegex:     os.Getenv("CAFE_ALLOW_REGEX") == "1",
+		TLSCert:        os.Getenv("TLS_CERT"),
+		TLSKey:         os.Getenv("TLS_KEY"),
+		DataPaths:      os.Getenv("CAFE_DATA"),
+		ReloadToken:    os.Getenv("RELOAD_TOKEN"),
+		AdminUser:      os.Getenv("ADMIN_USER"),
+		AdminPass:      os.Getenv("ADMIN_PASS"),
+		APIKeys:        envList("API_KEYS"),
+		RandomSeed:     envSeed("CAFE_RANDOM_SEED"),
+		Debug:          os.Getenv("DEBUG") == "1",
+	}
+}
+
+// debugConfig — действующие настройки в ответе /debug/config.
+// Токены, пароли и ключи в него не попадают.
+type debugConfig struct {
+	Addr         string `json:"addr"`
+	MaxCount     int    `json:"maxCount"`
+	DefaultCount int    `json:"defaultCount"`
+	CacheMaxAge  int    `json:"cacheMaxAge"`
+	StrictParams bool   `json:"strictParams"`
+	DataSource   string `json:"dataSource"`
+}
+
+// NewDebugConfigHandler возвращает обработчик /debug/config, который
+// отдаёт в JSON основные настройки cfg после разбора окружения. Источник
+// данных — значение CAFE_DATA или builtin для встроенных данных.
+func NewDebugConfigHandler(cfg Config) http.HandlerFunc {
+	source := cfg.DataPaths
+	if source == "" {
+		source = "builtin"
+	}
+	dump := debugConfig{
+		Addr:         cfg.Addr,
+		MaxCount:     cfg.MaxCount,
+		DefaultCount: cfg.DefaultCount,
+		CacheMaxAge:  cfg.CacheMaxAge,
+		StrictParams: cfg.StrictParams,
+		DataSource:   source,
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, req, dump)
+	}
+}
+
+// envString возвращает значение переменной окружения name
+// или def, если переменная не задана.
+func envString(name, def string) string {
+	if s := os.Getenv(name); s != "" {
+		return s
+	}
+	return def
+}
+
+// envList возвращает непустые значения переменной окружения name,
+// перечисленные через запятую, или nil, если их нет.
+func envList(name string) []string {
+	var list []string
+	for _, s := range strings.Split(os.Getenv(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// envInt возвращает целое неотрицательное значение переменной окружения
+// name или def, если переменная не задана или задана некорректно.
+func envInt(name string, def int) int {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, using %d", name, s, def))
+		return def
+	}
+	return v
+}
+
+// envPositiveInt возвращает целое положительное значение переменной
+// окружения name или def, если переменная не задана или задана некорректно.
+func envPositiveInt(name string, def int) int {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, using %d", name, s, def))
+		return def
+	}
+	return v
+}
+
+// envSeed возвращает целое число из переменной окружения name или nil,
+// если переменная не задана или задана некорректно.
+func envSeed(name string) *int64 {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, ignoring", name, s))
+		return nil
+	}
+	return &v
+}
+
+// envFloat возвращает неотрицательное число из переменной окружения
+// name или def, если переменная не задана или задана некорректно.
+func envFloat(name string, def float64) float64 {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, using %g", name, s, def))
+		return def
+	}
+	return v
+}
+
+// envDuration возвращает неотрицательную длительность вида 5s или 500ms
+// из переменной окружения name или def, если переменная не задана
+// или задана некорректно.
+func envDuration(name string, def time.Duration) time.Duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, using %s", name, s, def))
+		return def
+	}
+	return v
+}
+
+// envLevel возвращает уровень журнала debug, info, warn или error
+// из переменной окружения name или def, если переменная не задана
+// или задана некорректно.
+func envLevel(name string, def slog.Level) slog.Level {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	var v slog.Level
+	if err := v.UnmarshalText([]byte(s)); err != nil {
+		slog.Warn(fmt.Sprintf("incorrect %s=%q, using %s", name, s, def))
+		return def
+	}
+	return v
+}
+
+// newLogger возвращает журнал, который пишет в w записи не ниже
+// cfg.LogLevel: JSON-объектами при LogFormat=json, иначе текстом.
+func newLogger(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	if cfg.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// tlsConfig загружает сертификат и ключ из cfg. Если не задано ни того,
+// ни другого, возвращает nil: сервер работает по HTTP. Ошибка возвращается,
+// если задан только один из путей или файлы не удалось загрузить.
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSCert == "" && cfg.TLSKey == "" {
+		return nil, nil
+	}
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		return nil, errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// validateAddr проверяет, что addr имеет вид host:port
+// с числовым портом от 0 до 65535.
+func validateAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("address %s: invalid port %q", addr, port)
+	}
+	return nil
+}
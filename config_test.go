@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvInt(t *testing.T) {
+	requests := []struct {
+		value string
+		want  int
+	}{
+		{"", 1000},
+		{"25", 25},
+		{"0", 0},
+		{"-5", 1000},
+		{"many", 1000},
+	}
+	for _, v := range requests {
+		t.Setenv("CAFE_TEST_INT", v.value)
+		assert.Equal(t, v.want, envInt("CAFE_TEST_INT", 1000), v.value)
+	}
+}
+
+func TestEnvPositiveInt(t *testing.T) {
+	requests := []struct {
+		value string
+		want  int
+	}{
+		{"", 1000},
+		{"25", 25},
+		{"1", 1},
+		{"0", 1000},
+		{"-5", 1000},
+		{"many", 1000},
+	}
+	for _, v := range requests {
+		t.Setenv("CAFE_TEST_INT", v.value)
+		assert.Equal(t, v.want, envPositiveInt("CAFE_TEST_INT", 1000), v.value)
+	}
+}
+
+func TestEnvFloat(t *testing.T) {
+	requests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 10},
+		{"2.5", 2.5},
+		{"0", 0},
+		{"-1", 10},
+		{"fast", 10},
+		{"Inf", 10},
+	}
+	for _, v := range requests {
+		t.Setenv("CAFE_TEST_FLOAT", v.value)
+		assert.Equal(t, v.want, envFloat("CAFE_TEST_FLOAT", 10), v.value)
+	}
+}
+
+func TestValidateAddr(t *testing.T) {
+	for _, addr := range []string{":8080", "127.0.0.1:0", "localhost:65535", "[::1]:80"} {
+		assert.NoError(t, validateAddr(addr), addr)
+	}
+	for _, addr := range []string{"", "8080", ":http", ":65536", ":-1", "localhost:", "a:b:c"} {
+		assert.Error(t, validateAddr(addr), addr)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	assert.Equal(t, DefaultConfig(), configFromEnv())
+
+	t.Setenv("ADDR", ":9090")
+	t.Setenv("CAFE_STRICT_PARAMS", "1")
+	t.Setenv("CAFE_MAX_COUNT", "50")
+	t.Setenv("CAFE_DEFAULT_COUNT", "0")
+	t.Setenv("RATE_LIMIT_RPS", "0")
+	t.Setenv("CAFE_MAX_SEARCH_LEN", "20")
+	t.Setenv("CAFE_MAX_BODY_SIZE", "1024")
+	t.Setenv("CAFE_ALLOW_REGEX", "1")
+	t.Setenv("TLS_CERT", "cert.pem")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("CAFE_DATA", "cafes.json")
+	t.Setenv("RELOAD_TOKEN", "secret")
+	t.Setenv("ADMIN_USER", "admin")
+	t.Setenv("API_KEYS", "key-1, ,key-2,")
+	t.Setenv("DEBUG", "1")
+	t.Setenv("CAFE_RANDOM_SEED", "-7")
+	cfg := configFromEnv()
+	assert.Equal(t, ":9090", cfg.Addr)
+	assert.True(t, cfg.StrictParams)
+	assert.Equal(t, 50, cfg.MaxCount)
+	assert.Equal(t, 0, cfg.DefaultCount)
+	assert.Equal(t, 0.0, cfg.RateLimit)
+	assert.Equal(t, 20, cfg.MaxSearchLen)
+	assert.True(t, cfg.AllowRegex)
+	assert.Equal(t, "cert.pem", cfg.TLSCert)
+	assert.Empty(t, cfg.TLSKey)
+	assert.Equal(t, slog.LevelDebug, cfg.LogLevel)
+	assert.Equal(t, "cafes.json", cfg.DataPaths)
+	assert.Equal(t, int64(1024), cfg.MaxBodySize)
+	// перечитываемые данные по умолчанию не кешируются
+	assert.Zero(t, cfg.CacheMaxAge)
+	assert.Equal(t, "secret", cfg.ReloadToken)
+	assert.Equal(t, "admin", cfg.AdminUser)
+	assert.Empty(t, cfg.AdminPass)
+	assert.Equal(t, []string{"key-1", "key-2"}, cfg.APIKeys)
+	assert.True(t, cfg.Debug)
+	require.NotNil(t, cfg.RandomSeed)
+	assert.Equal(t, int64(-7), *cfg.RandomSeed)
+
+	t.Setenv("CAFE_RANDOM_SEED", "seven")
+	assert.Nil(t, configFromEnv().RandomSeed)
+
+	// с MaxCount меньше 1 не отдать ни одного кафе, такие значения не принимаются
+	for _, v := range []string{"0", "-1"} {
+		t.Setenv("CAFE_MAX_COUNT", v)
+		assert.Equal(t, DefaultConfig().MaxCount, configFromEnv().MaxCount, v)
+	}
+	assert.Equal(t, DefaultConfig().CacheSize, cfg.CacheSize)
+}
+
+func TestEnvDuration(t *testing.T) {
+	requests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"250ms", 250 * time.Millisecond},
+		{"0", 0},
+		{"-1s", 5 * time.Second},
+		{"5", 5 * time.Second},
+		{"soon", 5 * time.Second},
+	}
+	for _, v := range requests {
+		t.Setenv("CAFE_TEST_DURATION", v.value)
+		assert.Equal(t, v.want, envDuration("CAFE_TEST_DURATION", 5*time.Second), v.value)
+	}
+}
+
+func TestEnvLevel(t *testing.T) {
+	requests := []struct {
+		value string
+		want  slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"verbose", slog.LevelInfo},
+	}
+	for _, v := range requests {
+		t.Setenv("CAFE_TEST_LEVEL", v.value)
+		assert.Equal(t, v.want, envLevel("CAFE_TEST_LEVEL", slog.LevelInfo), v.value)
+	}
+}
+
+// writeTestCert сохраняет самоподписанный сертификат для 127.0.0.1
+// и его ключ во временные файлы и возвращает пути к ним.
+func writeTestCert(t *testing.T) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	certPath, keyPath := writeTestCert(t)
+
+	cfg, err := tlsConfig(Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	for _, c := range []Config{
+		{TLSCert: certPath},
+		{TLSKey: keyPath},
+		{TLSCert: certPath, TLSKey: filepath.Join(t.TempDir(), "missing.pem")},
+		{TLSCert: keyPath, TLSKey: keyPath},
+	} {
+		_, err := tlsConfig(c)
+		assert.Error(t, err, "%+v", c)
+	}
+
+	cfg, err = tlsConfig(Config{TLSCert: certPath, TLSKey: keyPath})
+	require.NoError(t, err)
+	require.Len(t, cfg.Certificates, 1)
+
+	// сервер отвечает по HTTPS и корректно останавливается
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &http.Server{Handler: newMux(defaultStore)}, tls.NewListener(ln, cfg))
+	}()
+
+	pemCert, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(pemCert))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/v1/cafe?city=tula&count=1")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "Пир и мир", string(body))
+
+	cancel()
+	assert.NoError(t, <-served)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadCities читает данные о кафе из JSON-файла вида
+// {"moscow":{"timezone":"Europe/Moscow","cafes":["Мир кофе",
+// {"name":"Сладкоежка","rating":4.5,"hours":"08:00-22:00","tags":["dessert"],
+// "location":{"lat":55.75,"lon":37.62}}]}}.
+// Город без часового пояса можно записать списком кафе, а кафе
+// без дополнительных данных — строкой. Ключи городов должны быть
+// непустыми и в нижнем регистре, оценки — от 0 до 5, координаты —
+// в пределах ±90° широты и ±180° долготы, часовые пояса — из базы IANA.
+func loadCities(path string) (map[string]City, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cities map[string]City
+	if err := json.Unmarshal(data, &cities); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	// ключи перебираются по порядку, чтобы ошибка была воспроизводимой
+	aliases := make(map[string]string)
+	for _, city := range slices.Sorted(maps.Keys(cities)) {
+		if strings.TrimSpace(city) == "" {
+			return nil, fmt.Errorf("parse %s: empty city name", path)
+		}
+		if city != normalizeCity(city) {
+			return nil, fmt.Errorf("parse %s: city %q must be lowercase without surrounding spaces", path, city)
+		}
+		if zone := cities[city].Timezone; zone != "" {
+			if _, err := time.LoadLocation(zone); err != nil {
+				return nil, fmt.Errorf("parse %s: city %q: unknown timezone %q", path, city, zone)
+			}
+		}
+		for _, alias := range cities[city].Aliases {
+			if alias == "" || alias != normalizeCity(alias) {
+				return nil, fmt.Errorf("parse %s: city %q: alias %q must be lowercase without surrounding spaces", path, city, alias)
+			}
+			if _, ok := cities[alias]; ok {
+				return nil, fmt.Errorf("parse %s: city %q: alias %q is a city name", path, city, alias)
+			}
+			if other, ok := aliases[alias]; ok {
+				return nil, fmt.Errorf("parse %s: alias %q is used by %q and %q", path, alias, other, city)
+			}
+			aliases[alias] = city
+		}
+		for _, c := range cities[city].Cafes {
+			if c.Rating != nil && (*c.Rating < 0 || *c.Rating > 5) {
+				return nil, fmt.Errorf("parse %s: cafe %q in %s: rating must be between 0 and 5", path, c.Name, city)
+			}
+			if c.Location != nil && !c.Location.valid() {
+				return nil, fmt.Errorf("parse %s: cafe %q in %s: location out of range", path, c.Name, city)
+			}
+		}
+	}
+	return cities, nil
+}
+
+// loadData читает и объединяет файлы данных из списка paths через
+// запятую. Вместо файла можно указать каталог: из него читаются все
+// файлы *.json по алфавиту. Город из более позднего файла заменяет
+// одноимённый город из предыдущих, о чём пишется предупреждение.
+// Если хотя бы один файл некорректен, возвращается ошибка.
+func loadData(paths string) (map[string]City, error) {
+	var files []string
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		// Glob возвращает имена уже отсортированными
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no data files in %q", paths)
+	}
+
+	cities := make(map[string]City)
+	source := make(map[string]string) // файл, из которого взят город
+	for _, file := range files {
+		loaded, err := loadCities(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, city := range slices.Sorted(maps.Keys(loaded)) {
+			if prev, ok := source[city]; ok {
+				slog.Warn("city is overridden by a later data file", "city", city, "file", file, "previous", prev)
+			}
+			cities[city] = loaded[city]
+			source[city] = file
+		}
+	}
+	// синонимы проверены внутри каждого файла, но могут
+	// столкнуться с городами и синонимами из других файлов
+	aliases := make(map[string]string)
+	for _, city := range slices.Sorted(maps.Keys(cities)) {
+		for _, alias := range cities[city].Aliases {
+			if _, ok := cities[alias]; ok {
+				return nil, fmt.Errorf("parse %s: city %q: alias %q is a city name", source[city], city, alias)
+			}
+			if other, ok := aliases[alias]; ok {
+				return nil, fmt.Errorf("parse %s: alias %q is used by %q and %q", source[city], alias, other, city)
+			}
+			aliases[alias] = city
+		}
+	}
+	return cities, nil
+}
+
+// NewReloadHandler возвращает обработчик POST /reload: перечитывает
+// файлы данных paths, как loadData, подменяет данные store и отвечает
+// общим числом кафе. Запрос без верных учётных данных auth получает 401.
+// Если файлы не удалось прочитать, остаются прежние данные, а ответ — 500.
+func NewReloadHandler(store *MemoryStore, paths string, auth adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, req, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !auth.allow(req) {
+			auth.deny(w, req)
+			return
+		}
+		total, err := reloadData(store, paths)
+		if err != nil {
+			writeError(w, req, http.StatusInternalServerError, "reload failed")
+			return
+		}
+		writeText(w, strconv.Itoa(total))
+	}
+}
+
+// reloadData перечитывает файлы данных paths, как loadData, подменяет
+// данные store и возвращает общее число кафе. Результат пишется в журнал
+// одинаково, чем бы ни была вызвана перезагрузка: неудача — как ошибка,
+// при этом остаются прежние данные.
+func reloadData(store *MemoryStore, paths string) (int, error) {
+	cities, err := loadData(paths)
+	if err != nil {
+		slog.Error("reload cafe data failed, keeping previous data", "path", paths, "err", err)
+		return 0, err
+	}
+	store.ReplaceCities(cities)
+	total := 0
+	for _, city := range cities {
+		total += len(city.Cafes)
+	}
+	slog.Info("reloaded cafe data", "path", paths, "cafes", total)
+	return total, nil
+}
+
+// reloadOnSignal перечитывает файлы данных paths, как loadData, при каждом
+// сигнале из sig и подменяет данные store. Если файлы не удалось прочитать,
+// остаются прежние данные.
+func reloadOnSignal(store *MemoryStore, paths string, sig <-chan os.Signal) {
+	for range sig {
+		reloadData(store, paths)
+	}
+}
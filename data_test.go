@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDataFile сохраняет content во временный файл и возвращает путь к нему.
+func writeDataFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cafes.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadCafes(t *testing.T) {
+	path := writeDataFile(t, `{
+		"kazan":{"timezone":"Europe/Moscow","aliases":["казань"],"cafes":["Чак-чак",{"name":"Эчпочмак","rating":4.5}]},
+		"tula":[]
+	}`)
+
+	cities, err := loadCities(path)
+	require.NoError(t, err)
+	rating := 4.5
+	assert.Equal(t, map[string]City{
+		"kazan": {Timezone: "Europe/Moscow", Aliases: []string{"казань"}, Cafes: []Cafe{{Name: "Чак-чак"}, {Name: "Эчпочмак", Rating: &rating}}},
+		"tula":  {Cafes: []Cafe{}},
+	}, cities)
+}
+
+func TestLoadCafesInvalid(t *testing.T) {
+	requests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed", `{"kazan":["Чак-чак"`},
+		{"not a map", `["Чак-чак"]`},
+		{"empty city", `{"":["Чак-чак"]}`},
+		{"uppercase city", `{"Kazan":["Чак-чак"]}`},
+		{"spaces", `{" kazan":["Чак-чак"]}`},
+		{"rating too high", `{"kazan":[{"name":"Чак-чак","rating":5.5}]}`},
+		{"negative rating", `{"kazan":[{"name":"Чак-чак","rating":-1}]}`},
+		{"bad rating", `{"kazan":[{"name":"Чак-чак","rating":"high"}]}`},
+		{"bad hours", `{"kazan":[{"name":"Чак-чак","hours":"08:00"}]}`},
+		{"latitude out of range", `{"kazan":[{"name":"Чак-чак","location":{"lat":95,"lon":49.1}}]}`},
+		{"longitude out of range", `{"kazan":[{"name":"Чак-чак","location":{"lat":55.8,"lon":-181}}]}`},
+		{"unknown timezone", `{"kazan":{"timezone":"Europe/Kazan","cafes":[]}}`},
+		{"uppercase alias", `{"kazan":{"aliases":["Казань"],"cafes":[]}}`},
+		{"empty alias", `{"kazan":{"aliases":[""],"cafes":[]}}`},
+		{"alias is a city", `{"kazan":{"aliases":["tula"],"cafes":[]},"tula":[]}`},
+		{"shared alias", `{"kazan":{"aliases":["город"],"cafes":[]},"tula":{"aliases":["город"],"cafes":[]}}`},
+	}
+	for _, v := range requests {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := loadCities(writeDataFile(t, v.content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := loadCities(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	path := writeDataFile(t, `{"kazan":["Чак-чак"]}`)
+	cities, err := loadCities(path)
+	require.NoError(t, err)
+	store := NewMemoryStoreFromCities(cities)
+
+	sig := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		reloadOnSignal(store, path, sig)
+		close(done)
+	}()
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"kazan":["Эчпочмак"],"tula":[]}`), 0o644))
+	sig <- syscall.SIGHUP
+	// сигнал принят ещё до перечитывания, поэтому файл меняется
+	// только после того, как новые данные появились в store
+	require.Eventually(t, func() bool {
+		return len(store.Cities()) == 2
+	}, time.Second, time.Millisecond)
+	// некорректный файл не должен затирать загруженные данные
+	require.NoError(t, os.WriteFile(path, []byte(`{"kazan":`), 0o644))
+	sig <- syscall.SIGHUP
+	close(sig)
+	<-done
+
+	cafe, ok := store.Cafes("kazan")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Эчпочмак"}, cafe)
+	assert.Equal(t, []string{"kazan", "tula"}, store.Cities())
+}
+
+func TestLoadCafesErrorDeterministic(t *testing.T) {
+	path := writeDataFile(t, `{"Tula":[],"Kazan":[],"Omsk":[],"Perm":[]}`)
+
+	for i := 0; i < 20; i++ {
+		_, err := loadCities(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"Kazan"`)
+	}
+}
+
+func TestLoadData(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+	kazan := write("kazan.json", `{"kazan":["Чак-чак"],"tula":["Пир и мир"]}`)
+	tula := write("tula.json", `{"tula":{"aliases":["тула"],"cafes":["Поздний завтрак"]}}`)
+	write("notes.txt", `не данные`)
+
+	// более поздний файл заменяет город из предыдущего
+	cities, err := loadData(kazan + ", " + tula)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]City{
+		"kazan": {Cafes: []Cafe{{Name: "Чак-чак"}}},
+		"tula":  {Aliases: []string{"тула"}, Cafes: []Cafe{{Name: "Поздний завтрак"}}},
+	}, cities)
+
+	cities, err = loadData(tula + "," + kazan)
+	require.NoError(t, err)
+	assert.Equal(t, City{Cafes: []Cafe{{Name: "Пир и мир"}}}, cities["tula"])
+
+	// из каталога читаются только файлы *.json по алфавиту
+	cities, err = loadData(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Cafe{{Name: "Поздний завтрак"}}, cities["tula"].Cafes)
+	assert.Len(t, cities, 2)
+
+	invalid := []string{
+		kazan + "," + writeDataFile(t, `{"omsk":`),
+		kazan + "," + filepath.Join(dir, "missing.json"),
+		tula + "," + writeDataFile(t, `{"perm":{"aliases":["тула"],"cafes":[]}}`),
+		kazan + "," + writeDataFile(t, `{"omsk":{"aliases":["kazan"],"cafes":[]}}`),
+		t.TempDir(),
+		" , ",
+	}
+	for _, paths := range invalid {
+		_, err := loadData(paths)
+		assert.Error(t, err, paths)
+	}
+}
+
+func TestReloadFailureLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	prevLogger, prevWriter, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prevLogger)
+		log.SetOutput(prevWriter)
+		log.SetFlags(prevFlags)
+	})
+	slog.SetDefault(newLogger(&buf, DefaultConfig()))
+
+	path := writeDataFile(t, `{"kazan":`)
+	store := NewMemoryStore(cafeList)
+	cfg := DefaultConfig()
+	cfg.DataPaths = path
+	cfg.ReloadToken = "secret"
+	mux := NewServer(store, cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	// неудача записывается одинаково, чем бы ни была вызвана перезагрузка
+	const want = `level=ERROR msg="reload cafe data failed, keeping previous data"`
+	req := httptest.NewRequest("POST", "/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, req)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Contains(t, buf.String(), want)
+
+	buf.Reset()
+	sig := make(chan os.Signal, 1)
+	sig <- syscall.SIGHUP
+	close(sig)
+	reloadOnSignal(store, path, sig)
+	assert.Contains(t, buf.String(), want)
+	// прежние данные остались
+	cafe, ok := store.Cafes("tula")
+	assert.True(t, ok)
+	assert.Equal(t, cafeList["tula"], cafe)
+}
+
+func TestReloadHandler(t *testing.T) {
+	path := writeDataFile(t, `{"kazan":["Чак-чак"]}`)
+	cities, err := loadData(path)
+	require.NoError(t, err)
+	store := NewMemoryStoreFromCities(cities)
+	cfg := DefaultConfig()
+	cfg.DataPaths = path
+	cfg.ReloadToken = "secret"
+	mux := NewServer(store, cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"kazan":["Эчпочмак","Чак-чак"],"tula":["Пир и мир"]}`), 0o644))
+	requests := []struct {
+		method string
+		auth   string
+		status int
+		want   string
+	}{
+		{"GET", "Bearer secret", http.StatusMethodNotAllowed, "method not allowed"},
+		{"POST", "", http.StatusUnauthorized, "unauthorized"},
+		{"POST", "Bearer wrong", http.StatusUnauthorized, "unauthorized"},
+		{"POST", "secret", http.StatusUnauthorized, "unauthorized"},
+		{"POST", "Bearer secret", http.StatusOK, "3"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, "/reload", nil)
+		if v.auth != "" {
+			req.Header.Set("Authorization", v.auth)
+		}
+		mux.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.auth)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.auth)
+	}
+	assert.Equal(t, []string{"kazan", "tula"}, store.Cities())
+
+	// некорректный файл не должен затирать загруженные данные
+	require.NoError(t, os.WriteFile(path, []byte(`{"kazan":`), 0o644))
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	mux.ServeHTTP(response, req)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, []string{"kazan", "tula"}, store.Cities())
+
+	// без токена маршрута нет
+	cfg.ReloadToken = ""
+	response = httptest.NewRecorder()
+	NewServer(store, cfg, slog.New(slog.DiscardHandler), nil).mux().ServeHTTP(response, req)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
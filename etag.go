@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bufferRecorder копит ответ целиком, не отправляя его клиенту.
+type bufferRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+}
+
+func (r *bufferRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// headerRecorder — bufferRecorder со своими заголовками: ответ копится
+// отдельно от исходного writer и отправляется, только если он нужен.
+type headerRecorder struct {
+	bufferRecorder
+	header http.Header
+}
+
+func (r *headerRecorder) Header() http.Header {
+	return r.header
+}
+
+// etagHeaders перечисляет заголовки, которые описывают результат
+// наравне с телом: при одинаковом теле, но другом числе страниц
+// или другой стратегии поиска ETag тоже должен отличаться.
+var etagHeaders = []string{"X-Total-Count", "X-Page", "X-Per-Page", "X-Total-Pages", "Link", "X-Cafe-City", "X-Skipped", "X-Match-Strategy"}
+
+// etagHandler добавляет к успешным ответам next слабый ETag — FNV-хеш
+// тела и заголовков etagHeaders. Если ETag совпал с If-None-Match,
+// клиенту отвечает 304 без тела.
+func etagHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rec := &bufferRecorder{ResponseWriter: w}
+		next(rec, req)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		h := fnv.New64a()
+		for _, name := range etagHeaders {
+			// имя и нулевые байты отделяют значения друг от друга
+			fmt.Fprintf(h, "%s:%q\x00", name, w.Header().Values(name))
+		}
+		h.Write(rec.body.Bytes())
+		etag := `W/"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+		w.Header().Set("ETag", etag)
+		if etagMatch(req.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(rec.body.Bytes())
+	}
+}
+
+// etagMatch сообщает, есть ли etag в значении If-None-Match.
+// Сравнение слабое: префикс W/ не учитывается.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedStore реализуют хранилища, которые помнят время загрузки
+// или последнего изменения данных.
+type modifiedStore interface {
+	lastModified() time.Time
+}
+
+// lastModifiedWriter добавляет Last-Modified к ответам 200 и 304
+// и заменяет 200 на 304 без тела, если данные не менялись.
+type lastModifiedWriter struct {
+	http.ResponseWriter
+	modified    string // значение Last-Modified
+	notModified bool   // клиент получит 304 вместо 200
+	wroteHeader bool
+}
+
+func (w *lastModifiedWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code == http.StatusOK || code == http.StatusNotModified {
+			w.Header().Set("Last-Modified", w.modified)
+		}
+		if code != http.StatusOK {
+			w.notModified = false
+		}
+		if w.notModified {
+			code = http.StatusNotModified
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *lastModifiedWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notModified {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному writer.
+func (w *lastModifiedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// lastModifiedHandler добавляет к успешным ответам next заголовок
+// Last-Modified со временем загрузки данных store. Ответ на open=now
+// меняется и с ходом часов, поэтому для него это время не раньше начала
+// текущей минуты, по которой проверяются часы работы. Если в запросе нет
+// If-None-Match, а If-Modified-Since не раньше этого времени, клиенту
+// отвечает 304 без тела. Если store не помнит время, next не меняется.
+func lastModifiedHandler(next http.HandlerFunc, store CafeStore) http.HandlerFunc {
+	ms, ok := store.(modifiedStore)
+	if !ok {
+		return next
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		modified := ms.lastModified()
+		if dependsOnClock(req) {
+			if now := timeNow().Truncate(time.Minute); now.After(modified) {
+				modified = now
+			}
+		}
+		// в HTTP-датах нет долей секунды
+		modified = modified.UTC().Truncate(time.Second)
+		lw := &lastModifiedWriter{ResponseWriter: w, modified: modified.Format(http.TimeFormat)}
+		// If-None-Match важнее If-Modified-Since, его проверяет etagHandler
+		if req.Header.Get("If-None-Match") == "" {
+			if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+				lw.notModified = !modified.After(since)
+			}
+		}
+		next(lw, req)
+	}
+}
+
+// cacheControlWriter выставляет Cache-Control по коду ответа
+// перед отправкой заголовков.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string // для успешных ответов
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code < http.StatusBadRequest {
+			w.Header().Set("Cache-Control", w.value)
+			// ответ зависит от формата и языка, которые выбирает клиент
+			w.Header().Add("Vary", "Accept, Accept-Language")
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному writer.
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cacheControlHandler разрешает кешировать успешные ответы next
+// и ответы 304 на maxAge секунд, а ответы с ошибкой запрещает кешировать.
+func cacheControlHandler(next http.HandlerFunc, maxAge int) http.HandlerFunc {
+	value := "public, max-age=" + strconv.Itoa(maxAge)
+	return func(w http.ResponseWriter, req *http.Request) {
+		next(&cacheControlWriter{ResponseWriter: w, value: value}, req)
+	}
+}
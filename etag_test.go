@@ -0,0 +1,252 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCafeETag(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	handler := NewHandler(store)
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		handler.ServeHTTP(response, req)
+		return response
+	}
+
+	first := get("/cafe?city=moscow", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.Regexp(t, `^W/"[0-9a-f]+"$`, etag)
+
+	// тот же запрос даёт тот же ETag
+	assert.Equal(t, etag, get("/cafe?city=moscow", "").Header().Get("ETag"))
+	// другое тело — другой ETag
+	assert.NotEqual(t, etag, get("/cafe?city=tula", "").Header().Get("ETag"))
+
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{etag[2:], http.StatusNotModified}, // сильная форма тоже подходит
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`W/"other"`, http.StatusOK},
+	}
+	for _, v := range tests {
+		response := get("/cafe?city=moscow", v.ifNoneMatch)
+		assert.Equal(t, v.status, response.Code, v.ifNoneMatch)
+		assert.Equal(t, etag, response.Header().Get("ETag"))
+		if v.status == http.StatusNotModified {
+			assert.Empty(t, response.Body.String())
+		}
+	}
+
+	// ошибки отдаются без ETag
+	response := get("/cafe?city=omsk", etag)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Empty(t, response.Header().Get("ETag"))
+
+	// после перезагрузки данных ETag меняется
+	store.Replace(map[string][]string{"moscow": {"Чайхона"}})
+	response = get("/cafe?city=moscow", etag)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotEqual(t, etag, response.Header().Get("ETag"))
+}
+
+func TestCafeETagHeaders(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	handler := NewHandler(store)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=tula&count=2", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		handler.ServeHTTP(response, req)
+		return response
+	}
+
+	first := get("")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+
+	// новое кафе попадает в конец списка: первая страница та же,
+	// но общее число кафе и страниц уже другое
+	require.NoError(t, store.Add("tula", "Дубок"))
+	response := get(etag)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, first.Body.String(), response.Body.String())
+	assert.NotEqual(t, first.Header().Get("X-Total-Count"), response.Header().Get("X-Total-Count"))
+	assert.NotEqual(t, etag, response.Header().Get("ETag"))
+}
+
+func TestCafeLastModified(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	loaded := time.Date(2024, 3, 1, 12, 30, 15, 500, time.UTC)
+	store.modTime = loaded
+	handler := NewHandler(store)
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		maps.Copy(req.Header, header)
+		handler.ServeHTTP(response, req)
+		return response
+	}
+	since := func(t time.Time) http.Header {
+		return http.Header{"If-Modified-Since": {t.Format(http.TimeFormat)}}
+	}
+
+	first := get("/cafe?city=moscow", nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "Fri, 01 Mar 2024 12:30:15 GMT", first.Header().Get("Last-Modified"))
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"same time", since(loaded), http.StatusNotModified},
+		{"later", since(loaded.Add(time.Hour)), http.StatusNotModified},
+		{"earlier", since(loaded.Add(-time.Second)), http.StatusOK},
+		{"invalid date", http.Header{"If-Modified-Since": {"yesterday"}}, http.StatusOK},
+		// If-None-Match важнее If-Modified-Since
+		{"etag mismatch", http.Header{"If-Modified-Since": {loaded.Format(http.TimeFormat)}, "If-None-Match": {`W/"other"`}}, http.StatusOK},
+		{"etag match", http.Header{"If-Modified-Since": {loaded.Add(-time.Hour).Format(http.TimeFormat)}, "If-None-Match": {first.Header().Get("ETag")}}, http.StatusNotModified},
+	}
+	for _, v := range tests {
+		response := get("/cafe?city=moscow", v.header)
+		assert.Equal(t, v.status, response.Code, v.name)
+		assert.Equal(t, first.Header().Get("Last-Modified"), response.Header().Get("Last-Modified"), v.name)
+		if v.status == http.StatusNotModified {
+			assert.Empty(t, response.Body.String(), v.name)
+		} else {
+			assert.Equal(t, first.Body.String(), response.Body.String(), v.name)
+		}
+	}
+
+	// ошибки отдаются без Last-Modified
+	response := get("/cafe?city=omsk", since(loaded))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Empty(t, response.Header().Get("Last-Modified"))
+
+	// после перезагрузки данных прежняя дата уже не подходит
+	store.Replace(map[string][]string{"moscow": {"Чайхона"}})
+	response = get("/cafe?city=moscow", since(loaded))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Чайхона", response.Body.String())
+	modified, err := http.ParseTime(response.Header().Get("Last-Modified"))
+	require.NoError(t, err)
+	assert.True(t, modified.After(loaded))
+	assert.Equal(t, http.StatusNotModified, get("/cafe?city=moscow", since(modified)).Code)
+}
+
+func TestCafeLastModifiedOpenNow(t *testing.T) {
+	saved := timeNow
+	t.Cleanup(func() { timeNow = saved })
+	// 12:00 в UTC — 15:00 в Москве
+	afternoon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return afternoon }
+
+	store := NewMemoryStoreFromCities(map[string]City{
+		"moscow": {Timezone: "Europe/Moscow", Cafes: []Cafe{
+			{Name: "День", Hours: &Hours{Open: 8 * 60, Close: 22 * 60}},
+			{Name: "Ночь", Hours: &Hours{Open: 22 * 60, Close: 8 * 60}},
+		}},
+	})
+	store.modTime = afternoon.Add(-24 * time.Hour)
+	handler := NewHandler(store)
+
+	get := func(target, since string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		handler.ServeHTTP(response, req)
+		return response
+	}
+
+	first := get("/cafe?city=moscow&open=now", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "День", first.Body.String())
+	modified := first.Header().Get("Last-Modified")
+	assert.Equal(t, afternoon.Format(http.TimeFormat), modified)
+	// в ту же минуту ответ не меняется
+	assert.Equal(t, http.StatusNotModified, get("/cafe?city=moscow&open=now", modified).Code)
+
+	// в 22:00 по Москве открыто уже другое кафе
+	timeNow = func() time.Time { return afternoon.Add(7 * time.Hour) }
+	response := get("/cafe?city=moscow&open=now", modified)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Ночь", response.Body.String())
+
+	// при явном at ответ от часов не зависит
+	response = get("/cafe?city=moscow&open=now&at=15:00", store.modTime.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, response.Code)
+}
+
+func TestCafeCacheControl(t *testing.T) {
+	handler := NewHandler(NewMemoryStore(cafeList))
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow", http.StatusOK, "public, max-age=60"},
+		{"/cafe?city=omsk", http.StatusBadRequest, "no-store"},
+		{"/cafe?city=moscow&count=-5", http.StatusBadRequest, "no-store"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", v.request, nil))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Header().Get("Cache-Control"), v.request)
+	}
+
+	// 304 тоже можно кешировать, а ответ различается по формату и языку
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=moscow", nil))
+	req := httptest.NewRequest("GET", "/cafe?city=moscow", nil)
+	req.Header.Set("If-None-Match", response.Header().Get("ETag"))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	assert.Equal(t, http.StatusNotModified, response.Code)
+	assert.Equal(t, "public, max-age=60", response.Header().Get("Cache-Control"))
+	assert.Equal(t, []string{"Accept, Accept-Language"}, response.Header().Values("Vary"))
+
+	cfg := DefaultConfig()
+	cfg.CacheMaxAge = 0
+	response = httptest.NewRecorder()
+	newCafeHandler(defaultStore, cfg).ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=tula", nil))
+	assert.Equal(t, "public, max-age=0", response.Header().Get("Cache-Control"))
+}
+
+func TestCacheControlKeepsVary(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CORSOrigin = "https://example.com"
+	handler := NewServer(defaultStore, cfg, slog.New(slog.DiscardHandler), nil).Routes()
+
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/cafe?city=tula", nil)
+	req.Header.Set("Origin", "https://example.com")
+	handler.ServeHTTP(response, req)
+	assert.ElementsMatch(t, []string{"Origin", "Accept, Accept-Language", "Accept-Encoding"}, response.Header().Values("Vary"))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+)
+
+// Обработчик можно собрать поверх любого CafeStore, например поверх
+// mockStore с собственными городами.
+func ExampleNewHandler() {
+	handler := NewHandler(mockStore{
+		"kazan": {"Чак-чак", "Эчпочмак", "Кофейня у Кремля"},
+		"sochi": {"Морской бриз", "Кофе на пляже"},
+	})
+
+	for _, target := range []string{
+		"/cafe?city=kazan&search=кофе",
+		"/cafe?city=sochi&count=1",
+		"/cafe?city=kazan,sochi&search=кофе",
+	} {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", target, nil))
+		fmt.Println(response.Code, response.Body.String())
+	}
+	// Output:
+	// 200 Кофейня у Кремля
+	// 200 Морской бриз
+	// 200 Кофейня у Кремля,Кофе на пляже
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Point — координаты кафе в градусах WGS 84.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// valid сообщает, лежат ли координаты в допустимых пределах.
+func (p Point) valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// earthRadius — средний радиус Земли в метрах.
+const earthRadius = 6371000
+
+// distance возвращает расстояние между p и q в метрах по формуле гаверсинусов.
+func distance(p, q Point) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (q.Lon - p.Lon) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// parsePoint разбирает широту lat и долготу lon в градусах.
+func parsePoint(lat, lon string) (Point, bool) {
+	var p Point
+	var err1, err2 error
+	p.Lat, err1 = strconv.ParseFloat(lat, 64)
+	p.Lon, err2 = strconv.ParseFloat(lon, 64)
+	return p, err1 == nil && err2 == nil && p.valid()
+}
+
+// nearCafe — кафе вместе с расстоянием до него в метрах.
+type nearCafe struct {
+	Cafe
+	Distance int `json:"distance"`
+}
+
+// NewNearestHandler возвращает обработчик /cafe/nearest: count ближайших
+// к точке lat, lon кафе города city по возрастанию расстояния. Значение
+// count по умолчанию и его предел берутся из cfg, как в /cafe. Кафе без
+// координат пропускаются. В JSON у каждого кафе есть расстояние distance
+// в метрах, в тексте отдаются только названия.
+func NewNearestHandler(store CafeStore, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		at, ok := parsePoint(req.FormValue("lat"), req.FormValue("lon"))
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "incorrect coordinates")
+			return
+		}
+		count, err := requestCount(req, cfg)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, "incorrect count")
+			return
+		}
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := store.Details(city)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+
+		var near []nearCafe
+		for _, c := range cafe {
+			if c.Location != nil {
+				near = append(near, nearCafe{Cafe: c, Distance: int(math.Round(distance(at, *c.Location)))})
+			}
+		}
+		slices.SortStableFunc(near, func(a, b nearCafe) int { return cmp.Compare(a.Distance, b.Distance) })
+		if count == -1 || count > len(near) {
+			count = len(near)
+		}
+		near = near[:count]
+
+		if acceptsJSON(req) {
+			if near == nil {
+				near = []nearCafe{}
+			}
+			writeJSON(w, req, near)
+			return
+		}
+		names := make([]string, 0, len(near))
+		for _, c := range near {
+			names = append(names, c.Name)
+		}
+		writeText(w, strings.Join(names, ","))
+	}
+}
+
+// geoFeature — точка GeoJSON по RFC 7946 с названием кафе.
+type geoFeature struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Name string `json:"name"`
+		City string `json:"city"`
+	} `json:"properties"`
+}
+
+// geoFeatureCollection — ответ в формате GeoJSON.
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+// writeGeoJSON записывает кафе с координатами в ответ как FeatureCollection
+// из точек. Кафе без координат пропускаются, их число сообщается
+// в заголовке X-Skipped.
+func writeGeoJSON(w http.ResponseWriter, items []cityCafe) {
+	collection := geoFeatureCollection{Type: "FeatureCollection", Features: []geoFeature{}}
+	skipped := 0
+	for _, c := range items {
+		if c.cafe.Location == nil {
+			skipped++
+			continue
+		}
+		var f geoFeature
+		f.Type = "Feature"
+		f.Geometry.Type = "Point"
+		// в GeoJSON долгота идёт перед широтой
+		f.Geometry.Coordinates = [2]float64{c.cafe.Location.Lon, c.cafe.Location.Lat}
+		f.Properties.Name = c.cafe.Name
+		f.Properties.City = c.city
+		collection.Features = append(collection.Features, f)
+	}
+	data, err := json.Marshal(collection)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("X-Skipped", strconv.Itoa(skipped))
+	w.Write(data)
+}
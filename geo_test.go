@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCafeGeoJSON(t *testing.T) {
+	handler := NewHandler(NewMemoryStoreFromCafes(map[string][]Cafe{
+		"moscow": {
+			{Name: "Мир кофе", Location: &Point{Lat: 55.75, Lon: 37.62}},
+			{Name: "Сладкоежка"},
+			{Name: "Кофе и завтраки", Location: &Point{Lat: 55.76, Lon: 37.6}},
+		},
+		"tula": {{Name: "Пир и мир", Location: &Point{Lat: 54.19, Lon: 37.62}}},
+	}))
+
+	requests := []struct {
+		request string
+		accept  string
+		skipped string
+		want    string
+	}{
+		{"/cafe?city=moscow&format=geojson", "", "1", `{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[37.62,55.75]},"properties":{"name":"Мир кофе","city":"moscow"}},` +
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[37.6,55.76]},"properties":{"name":"Кофе и завтраки","city":"moscow"}}]}`},
+		{"/cafe?city=moscow&search=кофе&count=1", "application/geo+json", "0", `{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[37.62,55.75]},"properties":{"name":"Мир кофе","city":"moscow"}}]}`},
+		{"/cafe?city=moscow&search=сладко&format=geojson", "", "1", `{"type":"FeatureCollection","features":[]}`},
+		{"/cafe?city=tula,moscow&format=geojson&count=2", "", "0", `{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[37.62,54.19]},"properties":{"name":"Пир и мир","city":"tula"}},` +
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[37.62,55.75]},"properties":{"name":"Мир кофе","city":"moscow"}}]}`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept", v.accept)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, "application/geo+json", response.Header().Get("Content-Type"), v.request)
+		assert.Equal(t, v.skipped, response.Header().Get("X-Skipped"), v.request)
+		assert.JSONEq(t, v.want, response.Body.String(), v.request)
+	}
+
+	// в обычном JSON координаты отдаются вместе с кафе
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=tula&format=json", nil))
+	assert.JSONEq(t, `[{"name":"Пир и мир","location":{"lat":54.19,"lon":37.62}}]`, response.Body.String())
+}
+
+func TestDistance(t *testing.T) {
+	// Красная площадь — Тульский кремль, около 173 км
+	d := distance(Point{Lat: 55.7539, Lon: 37.6208}, Point{Lat: 54.1961, Lon: 37.6182})
+	assert.InDelta(t, 173300, d, 500)
+	assert.Zero(t, distance(Point{Lat: 55.75, Lon: 37.62}, Point{Lat: 55.75, Lon: 37.62}))
+}
+
+func TestCafeNearest(t *testing.T) {
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{
+		"moscow": {
+			{Name: "Мир кофе", Location: &Point{Lat: 55.76, Lon: 37.62}},
+			{Name: "Сладкоежка"},
+			{Name: "Кофе и завтраки", Location: &Point{Lat: 55.751, Lon: 37.62}},
+			{Name: "Сытый студент", Location: &Point{Lat: 55.8, Lon: 37.62}},
+		},
+		"tula": {{Name: "Пир и мир"}},
+	})
+	handler := NewNearestHandler(store, DefaultConfig())
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe/nearest?city=moscow&lat=55.75&lon=37.62", http.StatusOK, "Кофе и завтраки,Мир кофе,Сытый студент"},
+		{"/cafe/nearest?city=Moscow&lat=55.75&lon=37.62&count=2", http.StatusOK, "Кофе и завтраки,Мир кофе"},
+		{"/cafe/nearest?city=moscow&lat=55.81&lon=37.62&count=1", http.StatusOK, "Сытый студент"},
+		{"/cafe/nearest?city=moscow&lat=55.75&lon=37.62&count=-1", http.StatusOK, "Кофе и завтраки,Мир кофе,Сытый студент"},
+		{"/cafe/nearest?city=moscow&lat=55.75&lon=37.62&count=2&format=json", http.StatusOK,
+			`[{"name":"Кофе и завтраки","location":{"lat":55.751,"lon":37.62},"distance":111},` +
+				`{"name":"Мир кофе","location":{"lat":55.76,"lon":37.62},"distance":1112}]`},
+		{"/cafe/nearest?city=tula&lat=54.19&lon=37.62&format=json", http.StatusOK, `[]`},
+		{"/cafe/nearest?city=moscow&lat=55.75", http.StatusBadRequest, "incorrect coordinates"},
+		{"/cafe/nearest?city=moscow&lat=north&lon=37.62", http.StatusBadRequest, "incorrect coordinates"},
+		{"/cafe/nearest?city=moscow&lat=91&lon=37.62", http.StatusBadRequest, "incorrect coordinates"},
+		{"/cafe/nearest?city=moscow&lat=NaN&lon=37.62", http.StatusBadRequest, "incorrect coordinates"},
+		{"/cafe/nearest?city=moscow&lat=55.75&lon=37.62&count=-2", http.StatusBadRequest, "incorrect count"},
+		{"/cafe/nearest?city=omsk&lat=55.75&lon=37.62", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	t.Run("config", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.DefaultCount = 1
+		cfg.MaxCount = 2
+		handler := NewNearestHandler(store, cfg)
+
+		requests := []struct {
+			count string
+			want  string
+		}{
+			{"", "Кофе и завтраки"},
+			{"&count=5", "Кофе и завтраки,Мир кофе"},
+			{"&count=all", "Кофе и завтраки,Мир кофе,Сытый студент"},
+		}
+		for _, v := range requests {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe/nearest?city=moscow&lat=55.75&lon=37.62"+v.count, nil))
+
+			assert.Equal(t, http.StatusOK, response.Code, v.count)
+			assert.Equal(t, v.want, response.Body.String(), v.count)
+		}
+	})
+}
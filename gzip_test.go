@@ -0,0 +1,72 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCafeGzip(t *testing.T) {
+	handler := gzipHandler(http.HandlerFunc(mainHandle))
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&count=2", http.StatusOK, "Мир кофе,Сладкоежка"},
+		{"/cafe?city=moscow&count=0", http.StatusOK, ""},
+		{"/cafe?city=omsk", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		t.Run(v.request, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", v.request, nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, v.status, response.Code)
+			assert.Equal(t, "gzip", response.Header().Get("Content-Encoding"))
+
+			gz, err := gzip.NewReader(response.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(gz)
+			require.NoError(t, err)
+			assert.Equal(t, v.want, strings.TrimSpace(string(body)))
+		})
+	}
+}
+
+func TestCafeWithoutGzip(t *testing.T) {
+	handler := gzipHandler(http.HandlerFunc(mainHandle))
+
+	for _, encoding := range []string{"", "identity", "gzip;q=0"} {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=moscow&count=2", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Мир кофе,Сладкоежка", response.Body.String())
+	}
+}
+
+func TestGzipNoContent(t *testing.T) {
+	handler := gzipHandler(NewHandler(NewMemoryStore(cafeList)))
+
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/cafe?city=tula&name=Пир%20и%20мир", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(response, req)
+
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Empty(t, response.Header().Get("Content-Encoding"))
+	assert.Zero(t, response.Body.Len())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minutesPerDay — число минут в сутках.
+const minutesPerDay = 24 * 60
+
+// Hours — ежедневные часы работы кафе в минутах от полуночи.
+// Если Close раньше Open, кафе закрывается уже на следующие сутки,
+// например 20:00-02:00; при Close == Open кафе работает круглосуточно.
+type Hours struct {
+	Open  int
+	Close int
+}
+
+// IsOpen сообщает, работает ли кафе в минуту minute от полуночи.
+func (h Hours) IsOpen(minute int) bool {
+	switch {
+	case h.Open == h.Close:
+		return true
+	case h.Open < h.Close:
+		return minute >= h.Open && minute < h.Close
+	default:
+		// интервал переходит через полночь
+		return minute >= h.Open || minute < h.Close
+	}
+}
+
+// String записывает часы работы в виде 08:00-22:00.
+func (h Hours) String() string {
+	return formatClock(h.Open) + "-" + formatClock(h.Close)
+}
+
+func (h Hours) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+func (h *Hours) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	open, closing, ok := strings.Cut(s, "-")
+	if !ok {
+		return fmt.Errorf("hours %q: want HH:MM-HH:MM", s)
+	}
+	var err error
+	if h.Open, err = parseClock(open); err != nil {
+		return fmt.Errorf("hours %q: %w", s, err)
+	}
+	if h.Close, err = parseClock(closing); err != nil {
+		return fmt.Errorf("hours %q: %w", s, err)
+	}
+	return nil
+}
+
+// parseClock разбирает время вида 18:30 в минуты от полуночи.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("incorrect time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// formatClock записывает минуты от полуночи в виде 18:30.
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// minuteOfDay возвращает минуту от полуночи для момента t.
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoursIsOpen(t *testing.T) {
+	day := Hours{Open: 8 * 60, Close: 22 * 60}
+	night := Hours{Open: 20 * 60, Close: 2 * 60}
+	allDay := Hours{}
+
+	requests := []struct {
+		hours  Hours
+		at     string
+		isOpen bool
+	}{
+		{day, "07:59", false},
+		{day, "08:00", true},
+		{day, "21:59", true},
+		{day, "22:00", false},
+		{night, "19:59", false},
+		{night, "20:00", true},
+		{night, "23:59", true},
+		{night, "00:00", true},
+		{night, "01:59", true},
+		{night, "02:00", false},
+		{allDay, "03:00", true},
+	}
+	for _, v := range requests {
+		minute, err := parseClock(v.at)
+		require.NoError(t, err)
+		assert.Equal(t, v.isOpen, v.hours.IsOpen(minute), "%s at %s", v.hours, v.at)
+	}
+}
+
+func TestHoursJSON(t *testing.T) {
+	var h Hours
+	require.NoError(t, json.Unmarshal([]byte(`"20:30-02:00"`), &h))
+	assert.Equal(t, Hours{Open: 20*60 + 30, Close: 2 * 60}, h)
+
+	data, err := json.Marshal(h)
+	require.NoError(t, err)
+	assert.Equal(t, `"20:30-02:00"`, string(data))
+
+	for _, s := range []string{`"08:00"`, `"8-22"`, `"08:00-24:00"`, `"25:00-02:00"`, `8`} {
+		assert.Error(t, json.Unmarshal([]byte(s), &h), s)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// messages — переводы сообщений об ошибках. Ключ — английский текст,
+// который передаётся в writeError; английский используется по умолчанию.
+var messages = map[string]map[string]string{
+	"ru": {
+		"unknown city":            "неизвестный город",
+		"did you mean":            "возможно, имелся в виду",
+		"cafe not found":          "кафе не найдено",
+		"cafe not found in":       "кафе не найдено в городе",
+		"unknown parameter":       "неизвестный параметр",
+		"unknown field":           "неизвестное поле",
+		"duplicate parameter":     "повторяющийся параметр",
+		"incorrect count":         "некорректный count",
+		"incorrect offset":        "некорректный offset",
+		"incorrect delimiter":     "некорректный delimiter",
+		"incorrect format":        "некорректный format",
+		"incorrect sort":          "некорректный sort",
+		"incorrect match":         "некорректный match",
+		"incorrect mode":          "некорректный mode",
+		"incorrect maxDistance":   "некорректный maxDistance",
+		"incorrect minRating":     "некорректный minRating",
+		"incorrect minResults":    "некорректный minResults",
+		"incorrect open":          "некорректный open",
+		"incorrect at":            "некорректный at",
+		"incorrect coordinates":   "некорректные координаты",
+		"incorrect regex":         "некорректный regex",
+		"incorrect seed":          "некорректный seed",
+		"incorrect limit":         "некорректный limit",
+		"incorrect name":          "некорректное название",
+		"invalid callback":        "некорректный callback",
+		"invalid regex":           "некорректное регулярное выражение",
+		"regex too long":          "слишком длинное регулярное выражение",
+		"regex not allowed":       "регулярные выражения запрещены",
+		"search too long":         "слишком длинный search",
+		"invalid body":            "некорректное тело запроса",
+		"invalid characters":      "недопустимые символы",
+		"batch too large":         "слишком много запросов в пакете",
+		"request body too large":  "слишком большое тело запроса",
+		"no matches":              "ничего не найдено",
+		"method not allowed":      "метод не поддерживается",
+		"too many requests":       "слишком много запросов",
+		"timeout":                 "превышено время ожидания",
+		"streaming not supported": "потоковая передача не поддерживается",
+		"not ready":               "сервис не готов",
+		"not found":               "не найдено",
+		"unauthorized":            "требуется авторизация",
+		"reload failed":           "не удалось перечитать данные",
+		"internal error":          "внутренняя ошибка",
+	},
+}
+
+// languageMatcher выбирает язык ответа из поддерживаемых;
+// первый, английский, используется по умолчанию.
+var languageMatcher = language.NewMatcher([]language.Tag{language.English, language.Russian})
+
+// requestLanguage возвращает базовый код языка из заголовка
+// Accept-Language, например ru, или en, если подходящего нет.
+func requestLanguage(req *http.Request) string {
+	tag, _ := language.MatchStrings(languageMatcher, req.Header.Get("Accept-Language"))
+	base, _ := tag.Base()
+	return base.String()
+}
+
+// localize переводит сообщение msg на язык lang. Сообщения вида
+// «unknown city: omsk (did you mean tula?)» переводятся по самому длинному
+// известному началу, а остаток, например название города, сохраняется.
+// Сообщения без перевода возвращаются как есть.
+func localize(lang, msg string) string {
+	catalog, ok := messages[lang]
+	if !ok {
+		return msg
+	}
+	head := ""
+	for key := range catalog {
+		if len(key) <= len(head) || !strings.HasPrefix(msg, key) {
+			continue
+		}
+		if rest := msg[len(key):]; rest == "" || rest[0] == ':' || rest[0] == ' ' {
+			head = key
+		}
+	}
+	if head == "" {
+		return msg
+	}
+	rest := msg[len(head):]
+	if s, ok := catalog["did you mean"]; ok {
+		rest = strings.Replace(rest, "(did you mean ", "("+s+" ", 1)
+	}
+	return catalog[head] + rest
+}
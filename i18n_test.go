@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalizedErrors(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request  string
+		language string
+		status   int
+		want     string
+	}{
+		{"/cafe?city=omsk", "", http.StatusBadRequest, "unknown city"},
+		{"/cafe?city=omsk", "en-US,en;q=0.9", http.StatusBadRequest, "unknown city"},
+		{"/cafe?city=omsk", "ru", http.StatusBadRequest, "неизвестный город"},
+		{"/cafe?city=omsk", "fr-FR,ru;q=0.8,en;q=0.5", http.StatusBadRequest, "неизвестный город"},
+		{"/cafe?city=omsk", "de", http.StatusBadRequest, "unknown city"},
+		{"/cafe?city=moscow&count=na", "ru-RU", http.StatusBadRequest, "некорректный count"},
+		{"/cafe?city=tul", "ru", http.StatusBadRequest, "неизвестный город (возможно, имелся в виду tula?)"},
+		{"/cafe?city=moscow,omsk", "ru", http.StatusBadRequest, "неизвестный город: omsk"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept-Language", v.language)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	// JSON-ошибки переводятся так же
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/cafe?city=omsk&format=json", nil)
+	req.Header.Set("Accept-Language", "ru")
+	handler.ServeHTTP(response, req)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"error":"неизвестный город"}`, response.Body.String())
+
+	// ошибки других обработчиков тоже есть в каталоге
+	response = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/cafe/nearest?city=moscow&lat=north&lon=37.62", nil)
+	req.Header.Set("Accept-Language", "ru")
+	NewNearestHandler(NewMemoryStore(cafeList), DefaultConfig()).ServeHTTP(response, req)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "некорректные координаты", strings.TrimSpace(response.Body.String()))
+}
+
+func TestLocalize(t *testing.T) {
+	requests := []struct {
+		lang string
+		msg  string
+		want string
+	}{
+		{"en", "unknown city", "unknown city"},
+		{"ru", "unknown city", "неизвестный город"},
+		{"ru", "unknown parameter: limit", "неизвестный параметр: limit"},
+		{"ru", "cafe not found in tula", "кафе не найдено в городе tula"},
+		{"ru", "cafe not found", "кафе не найдено"},
+		{"ru", "unknown cityscape", "unknown cityscape"},
+		{"ru", "something else", "something else"},
+	}
+	for _, v := range requests {
+		assert.Equal(t, v.want, localize(v.lang, v.msg), v.msg)
+	}
+}
@@ -1,10 +1,33 @@
 package main
 
 import (
-	"io"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var cafeList = map[string][]string{
@@ -12,44 +35,1235 @@ var cafeList = map[string][]string{
 	"tula":   []string{"Пир и мир", "Красиво есть не запретишь", "Поздний завтрак"},
 }
 
+// cafeZones — часовые пояса городов из cafeList.
+var cafeZones = map[string]string{
+	"moscow": "Europe/Moscow",
+	"tula":   "Europe/Moscow",
+}
+
+// defaultStore — хранилище, заполненное данными из cafeList.
+var defaultStore = NewMemoryStoreFromCities(withZones(cafesFromNames(cafeList), cafeZones))
+
+// defaultServer работает с defaultStore и настройками из окружения.
+var defaultServer = NewServer(defaultStore, configFromEnv(), slog.Default(), nil)
+
+// delimiters сопоставляет значения параметра delimiter разделителям
+// названий в текстовом ответе.
+var delimiters = map[string]string{
+	"comma":     ",",
+	"newline":   "\n",
+	"semicolon": ";",
+	"tab":       "\t",
+}
+
+// cafeParams перечисляет параметры, которые понимает listCafeHandler.
+var cafeParams = []string{"at", "callback", "city", "count", "delimiter", "exclude", "featuredOnly", "fields", "fold", "format", "fuzzy", "includeUnknownHours", "match", "maxDistance", "minRating", "minResults", "mode", "offset", "open", "pretty", "regex", "search", "sort", "tag", "translit", "wholeWord"}
+
+// repeatableParams перечисляет параметры /cafe, которые можно
+// передать несколько раз.
+var repeatableParams = []string{"exclude", "tag"}
+
+// timeNow возвращает текущее время; в тестах подменяется.
+var timeNow = time.Now
+
+// normalizeCity приводит название города к виду ключа cafeList:
+// без пробелов по краям и в нижнем регистре.
+func normalizeCity(city string) string {
+	return strings.ToLower(strings.TrimSpace(city))
+}
+
+// aliasedStore реализуют хранилища, в которых у городов есть
+// другие названия, например москва для moscow.
+type aliasedStore interface {
+	resolve(city string) string
+}
+
+// resolveCity нормализует название города и, если это другое название
+// города из store, заменяет его ключом этого города.
+func resolveCity(store CafeStore, city string) string {
+	city = normalizeCity(city)
+	if s, ok := store.(aliasedStore); ok {
+		return s.resolve(city)
+	}
+	return city
+}
+
+// mainHandle обслуживает /cafe сервером defaultServer.
 func mainHandle(w http.ResponseWriter, req *http.Request) {
-	var err error
+	defaultServer.cafe(w, req)
+}
+
+// cafeMethods перечисляет методы, которые поддерживает /cafe.
+const cafeMethods = "GET, HEAD, POST, DELETE"
+
+// NewHandler возвращает обработчик /cafe, работающий с хранилищем store
+// с настройками по умолчанию.
+func NewHandler(store CafeStore) http.HandlerFunc {
+	return newCafeHandler(store, DefaultConfig())
+}
+
+// newCafeHandler возвращает обработчик /cafe с настройками cfg.
+func newCafeHandler(store CafeStore, cfg Config) http.HandlerFunc {
+	list := cacheControlHandler(lastModifiedHandler(etagHandler(listCafeHandler(store, newResponseCache(cfg.CacheSize), cfg)), store), cfg.CacheMaxAge)
+	add := addCafeHandler(store)
+	del := deleteCafeHandler(store)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			list(w, req)
+		case http.MethodHead:
+			// ответ формируется так же, как для GET, чтобы посчитать
+			// Content-Length, но тело клиенту не отправляется
+			rec := &bufferRecorder{ResponseWriter: w}
+			list(rec, req)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if rec.status != http.StatusNotModified {
+				w.Header().Set("Content-Length", strconv.Itoa(rec.body.Len()))
+			}
+			w.WriteHeader(rec.status)
+		case http.MethodPost:
+			add(w, req)
+		case http.MethodDelete:
+			del(w, req)
+		default:
+			w.Header().Set("Allow", cafeMethods)
+			writeError(w, req, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// storeError отвечает клиенту ошибкой хранилища с подходящим кодом.
+func storeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownCity):
+		writeError(w, req, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrCafeNotFound):
+		writeError(w, req, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, req, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// addCafeHandler добавляет новое кафе в город из параметра city.
+// Название передаётся в теле запроса: {"name":"Новое кафе"}.
+func addCafeHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Name string `json:"name"`
+		}
+
+		city := resolveCity(store, req.URL.Query().Get("city"))
+		if _, ok := store.Cafes(city); !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeBodyError(w, req, err, "incorrect name")
+			return
+		}
+		name := strings.TrimSpace(body.Name)
+		if name == "" {
+			writeError(w, req, http.StatusBadRequest, "incorrect name")
+			return
+		}
+		if err := store.Add(city, name); err != nil {
+			storeError(w, req, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// deleteCafeHandler удаляет кафе с названием name из города city.
+// Название сравнивается без учёта регистра, как и при поиске.
+func deleteCafeHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		city := resolveCity(store, req.URL.Query().Get("city"))
+		name := req.URL.Query().Get("name")
+
+		if err := store.Delete(city, name); err != nil {
+			storeError(w, req, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// unknownParam возвращает первый по алфавиту параметр запроса,
+// которого нет в allowed, или пустую строку.
+func unknownParam(req *http.Request, allowed []string) string {
+	for _, key := range slices.Sorted(maps.Keys(req.URL.Query())) {
+		if !slices.Contains(allowed, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+// duplicateParam возвращает первый по алфавиту параметр из names,
+// переданный в запросе больше одного раза, или пустую строку.
+func duplicateParam(req *http.Request, names []string) string {
+	query := req.URL.Query()
+	for _, key := range names {
+		if len(query[key]) > 1 {
+			return key
+		}
+	}
+	return ""
+}
+
+// parseCanonicalInt разбирает целое число, записанное ровно так, как его
+// записал бы strconv.Itoa: без пробелов, знака + и ведущих нулей.
+func parseCanonicalInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if strconv.Itoa(n) != s {
+		return 0, fmt.Errorf("non-canonical integer %q", s)
+	}
+	return n, nil
+}
+
+// parseCount разбирает параметр count: целое число не меньше -1
+// или all в любом регистре, что то же самое, что -1, — все кафе.
+func parseCount(s string) (int, error) {
+	if strings.EqualFold(s, "all") {
+		return -1, nil
+	}
+	n, err := parseCanonicalInt(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < -1 {
+		return 0, fmt.Errorf("count %d is less than -1", n)
+	}
+	return n, nil
+}
+
+// requestCount возвращает число кафе в ответе по параметру count запроса.
+// Если count не указан, то возвращается cfg.DefaultCount записей,
+// а при DefaultCount=0 — все; count=-1 означает «вернуть все кафе»,
+// другие отрицательные значения считаются ошибкой. count больше MaxCount,
+// в том числе взятый из DefaultCount, молча урезается, а count=-1
+// и count=all намеренно не ограничиваются.
+func requestCount(req *http.Request, cfg Config) (int, error) {
+	count := cfg.DefaultCount
+	if count == 0 {
+		count = -1
+	}
+	if s := req.FormValue("count"); s != "" {
+		var err error
+		if count, err = parseCount(s); err != nil {
+			return 0, err
+		}
+	}
+	if count > cfg.MaxCount {
+		count = cfg.MaxCount
+	}
+	return count, nil
+}
+
+// dependsOnClock сообщает, зависит ли ответ /cafe от текущего времени:
+// так бывает при open=now, если время не задано явно через at.
+func dependsOnClock(req *http.Request) bool {
+	return req.FormValue("open") == "now" && req.FormValue("at") == ""
+}
+
+// cafeFilters — разобранные параметры запроса к списку кафе.
+// Ответ зависит только от них, поэтому из них же строится ключ кеша.
+type cafeFilters struct {
+	cities              []string
+	count               int // -1 — все кафе
+	offset              int
+	query               searchQuery
+	delimiter           string
+	format              string
+	fields              []string // nil — все поля
+	callback            string
+	order               string
+	minRating           float64 // -1 — оценка не проверяется
+	openAt              int     // минута суток или -1
+	now                 time.Time
+	includeUnknownHours bool
+	featuredOnly        bool
+	pretty              bool
+	tags                []string
+	minResults          int
+}
+
+// key возвращает ключ кеша из всех полей, так что новый параметр
+// не забудется, а запросы, отличающиеся только записью, дают один ключ.
+// Поиск представлен своим key, а время — в UTC, чтобы в ключ
+// не попадали адреса regex и часового пояса.
+func (f cafeFilters) key() string {
+	query := f.query.key()
+	f.query = searchQuery{}
+	f.now = f.now.UTC()
+	return fmt.Sprintf("%#v %s", f, query)
+}
 
-	// если count не указан, то возвращается 25 записей
-	count := 25
-	countStr := req.FormValue("count")
-	if countStr != "" {
-		count, err = strconv.Atoi(countStr)
+// listCafeHandler возвращает кафе города city с учётом search, minRating,
+// open, at, tag, featuredOnly, sort, offset и count. Успешные ответы запоминаются в cache.
+func listCafeHandler(store CafeStore, cache *responseCache, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var err error
+		var f cafeFilters
+
+		if cfg.StrictParams {
+			if key := unknownParam(req, cafeParams); key != "" {
+				writeError(w, req, http.StatusBadRequest, "unknown parameter: "+key)
+				return
+			}
+		}
+		// повтор параметра скорее всего ошибка клиента, поэтому
+		// вместо выбора одного из значений запрос отклоняется
+		single := slices.DeleteFunc(slices.Clone(cafeParams), func(key string) bool {
+			return slices.Contains(repeatableParams, key)
+		})
+		if duplicateParam(req, single) != "" {
+			writeError(w, req, http.StatusBadRequest, "duplicate parameter")
+			return
+		}
+
+		f.count, err = requestCount(req, cfg)
 		if err != nil {
-			http.Error(w, "incorrect count", http.StatusBadRequest)
+			writeError(w, req, http.StatusBadRequest, "incorrect count")
 			return
 		}
+		if offsetStr := req.FormValue("offset"); offsetStr != "" {
+			f.offset, err = strconv.Atoi(offsetStr)
+			if err != nil || f.offset < 0 {
+				writeError(w, req, http.StatusBadRequest, "incorrect offset")
+				return
+			}
+		}
+		// длина считается в рунах, чтобы кириллица не была короче латиницы
+		if cfg.MaxSearchLen > 0 && utf8.RuneCountInString(req.FormValue("search")) > cfg.MaxSearchLen {
+			writeError(w, req, http.StatusBadRequest, "search too long")
+			return
+		}
+		f.query, err = parseSearch(req)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		// при regex=true search целиком считается регулярным выражением;
+		// выражение компилируется один раз на запрос
+		switch req.FormValue("regex") {
+		case "", "false":
+		case "true":
+			if !cfg.AllowRegex {
+				writeError(w, req, http.StatusBadRequest, "regex not allowed")
+				return
+			}
+			if search := strings.TrimSpace(req.FormValue("search")); search != "" {
+				if f.query.regex, err = compileRegex(search); err != nil {
+					writeError(w, req, http.StatusBadRequest, err.Error())
+					return
+				}
+				f.query.terms = nil
+			}
+		default:
+			writeError(w, req, http.StatusBadRequest, "incorrect regex")
+			return
+		}
+		f.delimiter = ","
+		if name := req.FormValue("delimiter"); name != "" {
+			var known bool
+			if f.delimiter, known = delimiters[name]; !known {
+				writeError(w, req, http.StatusBadRequest, "incorrect delimiter")
+				return
+			}
+		}
+		f.format, err = responseFormat(req)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		// fields проверяются при любом формате, но применяются только к JSON
+		f.fields, err = parseFields(req.FormValue("fields"))
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		// callback учитывается только при включённом JSONP и ответе в JSON
+		if cfg.JSONP && f.format == formatJSON {
+			f.callback = req.FormValue("callback")
+			if f.callback != "" && !callbackPattern.MatchString(f.callback) {
+				writeError(w, req, http.StatusBadRequest, "invalid callback")
+				return
+			}
+		}
+		f.order = req.FormValue("sort")
+		if f.order != "" && f.order != "name" && f.order != "name_desc" && f.order != "rating" {
+			writeError(w, req, http.StatusBadRequest, "incorrect sort")
+			return
+		}
+		// при minRating кафе без оценки не подходят
+		f.minRating = -1
+		if s := req.FormValue("minRating"); s != "" {
+			f.minRating, err = strconv.ParseFloat(s, 64)
+			if err != nil || f.minRating < 0 || math.IsNaN(f.minRating) || math.IsInf(f.minRating, 0) {
+				writeError(w, req, http.StatusBadRequest, "incorrect minRating")
+				return
+			}
+		}
+		// open=now оставляет кафе, открытые сейчас по времени их города,
+		// at=18:30 — открытые в указанное время; -1 означает, что часы
+		// работы не проверяются
+		f.openAt = -1
+		switch req.FormValue("open") {
+		case "":
+		case "now":
+			f.now = timeNow().Truncate(time.Minute)
+		default:
+			writeError(w, req, http.StatusBadRequest, "incorrect open")
+			return
+		}
+		if s := req.FormValue("at"); s != "" {
+			if f.openAt, err = parseClock(s); err != nil {
+				writeError(w, req, http.StatusBadRequest, "incorrect at")
+				return
+			}
+		}
+		f.includeUnknownHours = req.FormValue("includeUnknownHours") == "true"
+		f.featuredOnly = req.FormValue("featuredOnly") == "true"
+		// pretty меняет только запись JSON, но ответ всё равно другой
+		f.pretty = req.FormValue("pretty") == "true"
+		if s := req.FormValue("minResults"); s != "" {
+			if f.minResults, err = strconv.Atoi(s); err != nil || f.minResults < 0 {
+				writeError(w, req, http.StatusBadRequest, "incorrect minResults")
+				return
+			}
+		}
+		// несколько tag означают, что у кафе должны быть все эти метки
+		for _, tag := range req.URL.Query()["tag"] {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				f.tags = append(f.tags, tag)
+			}
+		}
+		// в city можно перечислить несколько городов через запятую,
+		// тогда кафе всех городов объединяются в один список
+		f.cities = parseCities(store, req.FormValue("city"))
+		slog.DebugContext(req.Context(), "cafe filters",
+			"cities", f.cities, "count", f.count, "offset", f.offset, "search", f.query.key(),
+			"format", f.format, "sort", f.order, "minRating", f.minRating, "open", f.openAt,
+			"includeUnknownHours", f.includeUnknownHours, "tags", f.tags, "featuredOnly", f.featuredOnly)
+		// без трассировки спан из контекста ничего не записывает
+		span := trace.SpanFromContext(req.Context())
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.StringSlice("cafe.city", f.cities),
+				attribute.String("cafe.search", req.FormValue("search")),
+				attribute.Int("cafe.count", f.count),
+			)
+		}
+		// ссылки на соседние страницы повторяют параметры именно этого
+		// запроса, поэтому добавляются к ответу мимо кеша
+		w = &linkWriter{
+			ResponseWriter: w,
+			links:          pageLinks{path: req.URL.Path, query: req.URL.Query()},
+			offset:         f.offset,
+			count:          f.count,
+		}
+		cache.serve(w, store, f.key(), func(w http.ResponseWriter) {
+			// collect возвращает кафе всех городов, подходящие под query
+			// и остальные фильтры. При ошибке она уже отправлена клиенту,
+			// а второе значение равно false.
+			collect := func(query searchQuery) ([]cityCafe, bool) {
+				var found []cityCafe
+				for _, city := range f.cities {
+					// после отмены запроса, например по таймауту,
+					// ответ уже никому не нужен
+					if req.Context().Err() != nil {
+						return nil, false
+					}
+					cafe, ok := findCafes(store, city, query)
+					if !ok {
+						msg := "unknown city"
+						if len(f.cities) > 1 {
+							msg += ": " + city
+						}
+						if suggestion := suggestCity(store, city); suggestion != "" {
+							msg += " (did you mean " + suggestion + "?)"
+						}
+						writeError(w, req, http.StatusBadRequest, msg)
+						return nil, false
+					}
+					openAt := f.openAt
+					if openAt < 0 && !f.now.IsZero() {
+						loc, err := store.Location(city)
+						if err != nil {
+							storeError(w, req, err)
+							return nil, false
+						}
+						openAt = minuteOfDay(f.now.In(loc))
+					}
+					for _, c := range cafe {
+						if req.Context().Err() != nil {
+							return nil, false
+						}
+						if f.minRating >= 0 && (c.Rating == nil || *c.Rating < f.minRating) {
+							continue
+						}
+						if !hasTags(c, f.tags) || f.featuredOnly && !c.Featured {
+							continue
+						}
+						// кафе с неизвестными часами работы подходят только
+						// при includeUnknownHours=true
+						if openAt >= 0 && (c.Hours == nil && !f.includeUnknownHours || c.Hours != nil && !c.Hours.IsOpen(openAt)) {
+							continue
+						}
+						found = append(found, cityCafe{city: city, cafe: c})
+					}
+				}
+				return found, true
+			}
+			found, ok := collect(f.query)
+			if !ok {
+				return
+			}
+			// при minResults поиск расширяется, пока кафе не хватает
+			if f.minResults > 0 {
+				strategy := "exact"
+				for _, broader := range f.query.broaden() {
+					if len(found) >= f.minResults {
+						break
+					}
+					if found, ok = collect(broader.query); !ok {
+						return
+					}
+					strategy = broader.name
+				}
+				w.Header().Set("X-Match-Strategy", strategy)
+			}
+			// число найденных кафе до обрезки по count
+			w.Header().Set("X-Total-Count", strconv.Itoa(len(found)))
+			// обработанные названия городов, чтобы клиент мог сопоставить ответ с запросом
+			w.Header().Set("X-Cafe-City", strings.Join(f.cities, ","))
+			// сортировка и offset применяются после поиска, но до обрезки по count
+			// без явного sort продвигаемые кафе поднимаются наверх
+			switch f.order {
+			case "":
+				sortFeatured(found)
+			case "rating":
+				sortByRating(found)
+			default:
+				sortByName(found, f.order, func(c cityCafe) string { return c.cafe.Name })
+			}
+			setPageHeaders(w.Header(), f.offset, f.count, len(found))
+			found = found[min(f.offset, len(found)):]
+			if f.count != -1 && f.count < len(found) {
+				found = found[:f.count]
+			}
+
+			cafe := make([]string, 0, len(found))
+			for _, c := range found {
+				cafe = append(cafe, c.cafe.Name)
+			}
+			switch f.format {
+			case formatJSON:
+				// в JSON кафе отдаются вместе с оценкой,
+				// для нескольких городов — сгруппированными по городам
+				grouped := make(map[string][]any, len(f.cities))
+				for _, city := range f.cities {
+					grouped[city] = []any{}
+				}
+				for _, c := range found {
+					var item any = c.cafe
+					if f.fields != nil {
+						projected, err := projectCafe(c.cafe, f.fields)
+						if err != nil {
+							writeError(w, req, http.StatusInternalServerError, "internal error")
+							return
+						}
+						item = projected
+					}
+					grouped[c.city] = append(grouped[c.city], item)
+				}
+				var v any = grouped
+				if len(f.cities) == 1 {
+					v = grouped[f.cities[0]]
+				}
+				if f.callback != "" {
+					writeJSONP(w, req, f.callback, v)
+					return
+				}
+				writeJSON(w, req, v)
+			case formatCSV:
+				writeCSV(w, cafe)
+			case formatXML:
+				writeXML(w, cafe)
+			case formatGeoJSON:
+				writeGeoJSON(w, found)
+			default:
+				answer := strings.Join(cafe, f.delimiter)
+				writeText(w, answer)
+			}
+		})
+		if span.IsRecording() {
+			// ответ мог прийти из кеша, поэтому размер выдачи
+			// восстанавливается по заголовкам
+			if total, err := strconv.Atoi(w.Header().Get("X-Total-Count")); err == nil {
+				size := max(0, total-f.offset)
+				if f.count != -1 {
+					size = min(size, f.count)
+				}
+				span.SetAttributes(attribute.Int("cafe.result_size", size))
+			}
+		}
+	}
+}
+
+// setPageHeaders сообщает в заголовках X-Page, X-Per-Page и X-Total-Pages,
+// какая страница из total найденных кафе отдана при offset и count.
+// Страницы нумеруются с 1, а offset не обязан быть кратным count.
+// При count=-1 все кафе считаются одной страницей, а при count=0
+// отдаётся одна пустая страница.
+func setPageHeaders(h http.Header, offset, count, total int) {
+	page, pages := 1, 1
+	switch {
+	case count > 0:
+		page = offset/count + 1
+		pages = max(1, (total+count-1)/count)
+	case count == -1:
+		count = total
+	}
+	h.Set("X-Page", strconv.Itoa(page))
+	h.Set("X-Per-Page", strconv.Itoa(count))
+	h.Set("X-Total-Pages", strconv.Itoa(pages))
+}
+
+// pageLinks строит ссылки на соседние страницы списка кафе
+// по пути и параметрам исходного запроса.
+type pageLinks struct {
+	path  string
+	query url.Values
+}
+
+// url возвращает адрес страницы с заданными offset и count;
+// остальные параметры запроса сохраняются.
+func (l pageLinks) url(offset, count int) string {
+	query := maps.Clone(l.query)
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("count", strconv.Itoa(count))
+	return l.path + "?" + query.Encode()
+}
+
+// set добавляет заголовки Link по RFC 8288 с rel="next" и rel="prev",
+// если после или до страницы из offset и count есть ещё кафе из total.
+// При count=-1 или count=0 ссылок нет.
+func (l pageLinks) set(h http.Header, offset, count, total int) {
+	if count <= 0 {
+		return
+	}
+	if offset+count < total {
+		h.Add("Link", "<"+l.url(offset+count, count)+`>; rel="next"`)
+	}
+	if offset > 0 {
+		h.Add("Link", "<"+l.url(max(0, offset-count), count)+`>; rel="prev"`)
+	}
+}
+
+// linkWriter перед первой записью успешного ответа добавляет заголовки
+// Link, когда число найденных кафе уже известно из X-Total-Count.
+type linkWriter struct {
+	http.ResponseWriter
+	links         pageLinks
+	offset, count int
+	started       bool
+}
+
+func (w *linkWriter) WriteHeader(code int) {
+	w.setLinks(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *linkWriter) Write(p []byte) (int, error) {
+	w.setLinks(http.StatusOK)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *linkWriter) setLinks(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	total, err := strconv.Atoi(w.Header().Get("X-Total-Count"))
+	if code == http.StatusOK && err == nil {
+		w.links.set(w.Header(), w.offset, w.count, total)
+	}
+}
+
+// maxSuggestDistance — наибольшее число правок, при котором
+// вместо неизвестного города предлагается похожий.
+const maxSuggestDistance = 2
+
+// suggestCity возвращает ближайший к city по расстоянию Левенштейна
+// город из store или пустую строку, если подходящего нет. Из равно
+// близких выбирается первый по алфавиту.
+func suggestCity(store CafeStore, city string) string {
+	if city == "" {
+		return ""
+	}
+	best, bestDistance := "", maxSuggestDistance+1
+	for _, known := range store.Cities() {
+		if d := levenshtein(city, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
 	}
-	city := req.FormValue("city")
-	cafe, ok := cafeList[city]
-	if !ok {
-		http.Error(w, "unknown city", http.StatusBadRequest)
+	return best
+}
+
+// cityCafe — кафе вместе с городом, в котором оно находится.
+type cityCafe struct {
+	city string
+	cafe Cafe
+}
+
+// parseCities разбирает список городов через запятую: нормализует
+// названия, заменяет другие названия городов ключами store,
+// пропускает пустые и повторы. Пустой список превращается
+// в один пустой город, которого нет в хранилище.
+func parseCities(store CafeStore, s string) []string {
+	var cities []string
+	for _, city := range strings.Split(s, ",") {
+		city = resolveCity(store, city)
+		if city != "" && !slices.Contains(cities, city) {
+			cities = append(cities, city)
+		}
+	}
+	if len(cities) == 0 {
+		return []string{""}
+	}
+	return cities
+}
+
+// sortCafes сортирует кафе по названию без учёта регистра:
+// order=name — по алфавиту, order=name_desc — в обратном порядке.
+// При пустом order сохраняется исходный порядок.
+func sortCafes(cafe []string, order string) {
+	sortByName(cafe, order, func(name string) string { return name })
+}
+
+// sortByName сортирует items как sortCafes, получая название через name.
+func sortByName[T any](items []T, order string, name func(T) string) {
+	if order == "" {
 		return
 	}
-	if search := req.FormValue("search"); search != "" {
-		var found []string
+	slices.SortStableFunc(items, func(a, b T) int {
+		c := strings.Compare(strings.ToLower(name(a)), strings.ToLower(name(b)))
+		if order == "name_desc" {
+			return -c
+		}
+		return c
+	})
+}
+
+// hasTags сообщает, есть ли у кафе c все метки tags.
+func hasTags(c Cafe, tags []string) bool {
+	for _, tag := range tags {
+		if !c.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortFeatured ставит продвигаемые кафе перед остальными,
+// сохраняя порядок внутри каждой группы.
+func sortFeatured(items []cityCafe) {
+	slices.SortStableFunc(items, func(a, b cityCafe) int {
+		switch {
+		case a.cafe.Featured == b.cafe.Featured:
+			return 0
+		case a.cafe.Featured:
+			return -1
+		default:
+			return 1
+		}
+	})
+}
+
+// sortByRating сортирует кафе по убыванию оценки; кафе без оценки
+// оказываются в конце. Кафе с равными оценками, как и кафе без оценки,
+// упорядочиваются по названию без учёта регистра, чтобы порядок
+// не зависел от порядка хранения.
+func sortByRating(items []cityCafe) {
+	slices.SortStableFunc(items, func(a, b cityCafe) int {
+		return cmp.Or(compareRatings(a.cafe.Rating, b.cafe.Rating),
+			strings.Compare(strings.ToLower(a.cafe.Name), strings.ToLower(b.cafe.Name)))
+	})
+}
+
+// compareRatings сравнивает оценки для сортировки по убыванию;
+// отсутствующая оценка считается меньше любой.
+func compareRatings(ra, rb *float64) int {
+	switch {
+	case ra == nil && rb == nil:
+		return 0
+	case ra == nil:
+		return 1
+	case rb == nil:
+		return -1
+	default:
+		return cmp.Compare(*rb, *ra)
+	}
+}
+
+// NewRandomHandler возвращает обработчик /cafe/random: одно случайное кафе
+// города city, при наличии search — только из подходящих под поиск.
+// Без city кафе выбирается равновероятно среди всех городов, а ответ
+// содержит и город: в JSON — поле city, в тексте — заголовок X-Cafe-City.
+// Параметр seed делает выбор детерминированным, а weighted=true —
+// вероятность выбора пропорциональной оценке.
+func NewRandomHandler(store CafeStore) http.HandlerFunc {
+	return newRandomHandler(store, nil)
+}
+
+// lockedSource — источник случайных чисел, который можно делить
+// между запросами: обращения к src по очереди защищены мьютексом.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+// Uint64 возвращает следующее число src.
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+// newRandomHandler — то же, что NewRandomHandler, но запросы без seed
+// берут случайные числа из общего генератора shared, например созданного
+// по CAFE_RANDOM_SEED. Если shared равен nil, у каждого запроса свой
+// генератор со случайным начальным значением. Параметр seed запроса
+// всегда важнее shared.
+func newRandomHandler(store CafeStore, shared *rand.Rand) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rnd := shared
+		if rnd == nil {
+			// у каждого запроса свой генератор, чтобы не делить общий источник
+			rnd = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		}
+		if seedStr := req.FormValue("seed"); seedStr != "" {
+			seed, err := strconv.ParseInt(seedStr, 10, 64)
+			if err != nil {
+				writeError(w, req, http.StatusBadRequest, "incorrect seed")
+				return
+			}
+			rnd = rand.New(rand.NewPCG(uint64(seed), 0))
+		}
+		query, err := parseSearch(req)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		// без city кафе выбирается среди кафе всех городов
+		global := req.FormValue("city") == ""
+		cities := store.Cities()
+		if !global {
+			cities = []string{resolveCity(store, req.FormValue("city"))}
+		}
+		var found []cityCafe
+		for _, city := range cities {
+			cafe, ok := findCafes(store, city, query)
+			if !ok {
+				writeError(w, req, http.StatusBadRequest, "unknown city")
+				return
+			}
+			for _, c := range cafe {
+				found = append(found, cityCafe{city: city, cafe: c})
+			}
+		}
+		if len(found) == 0 {
+			writeError(w, req, http.StatusNotFound, "no matches")
+			return
+		}
+		var picked cityCafe
+		if req.FormValue("weighted") == "true" {
+			picked = pickWeighted(rnd, found)
+		} else {
+			picked = found[rnd.IntN(len(found))]
+		}
+		if !global {
+			writeText(w, picked.cafe.Name)
+			return
+		}
+		w.Header().Set("X-Cafe-City", picked.city)
+		if acceptsJSON(req) {
+			writeJSON(w, req, randomCafe{City: picked.city, Name: picked.cafe.Name})
+			return
+		}
+		writeText(w, picked.cafe.Name)
+	}
+}
+
+// randomCafe — ответ /cafe/random без city в JSON.
+type randomCafe struct {
+	City string `json:"city"`
+	Name string `json:"name"`
+}
+
+// unratedWeight — вес кафе без оценки при взвешенном случайном выборе:
+// меньше любой заметной оценки, но не ноль, чтобы такие кафе тоже выпадали.
+const unratedWeight = 0.5
+
+// pickWeighted выбирает из непустого списка cafe одно кафе с вероятностью,
+// пропорциональной оценке. Если у всех кафе нулевой вес, выбор равновероятный.
+func pickWeighted(rnd *rand.Rand, cafe []cityCafe) cityCafe {
+	weights := make([]float64, len(cafe))
+	var total float64
+	for i, c := range cafe {
+		weights[i] = unratedWeight
+		if c.cafe.Rating != nil {
+			weights[i] = *c.cafe.Rating
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return cafe[rnd.IntN(len(cafe))]
+	}
+	x := rnd.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return cafe[i]
+		}
+		x -= w
+	}
+	return cafe[len(cafe)-1]
+}
+
+// NewLookupHandler возвращает обработчик /cafe/lookup: название кафе name
+// из города city в том виде, в каком оно хранится. Название ищется
+// без учёта регистра.
+func NewLookupHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := store.Cafes(city)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		name := strings.TrimSpace(req.FormValue("name"))
+		i := slices.IndexFunc(cafe, func(v string) bool {
+			return strings.EqualFold(v, name)
+		})
+		if i < 0 {
+			writeError(w, req, http.StatusNotFound, "cafe not found in "+city)
+			return
+		}
+		writeText(w, cafe[i])
+	}
+}
+
+// NewCountHandler возвращает обработчик /cafe/count: число кафе города
+// city, подходящих под search и другие параметры поиска. count и offset
+// не учитываются, так как ответ — общее число найденных кафе.
+func NewCountHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query, err := parseSearch(req)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := findCafes(store, city, query)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		if acceptsJSON(req) {
+			writeJSON(w, req, map[string]int{"count": len(cafe)})
+			return
+		}
+		writeText(w, strconv.Itoa(len(cafe)))
+	}
+}
+
+// NewIndexHandler возвращает обработчик /cafe/index для алфавитного
+// указателя: сколько кафе города city начинается с каждой буквы. Буква —
+// первая руна названия в верхнем регистре. Параметры поиска учитываются
+// так же, как в /cafe/count. В JSON ответ — объект буква — число,
+// в тексте — пары буква:число через запятую по порядку букв.
+func NewIndexHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query, err := parseSearch(req)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := findCafes(store, city, query)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		counts := make(map[string]int)
+		for _, c := range cafe {
+			if r, size := utf8.DecodeRuneInString(c.Name); size > 0 {
+				counts[string(unicode.ToUpper(r))]++
+			}
+		}
+
+		if acceptsJSON(req) {
+			writeJSON(w, req, counts)
+			return
+		}
+		letters := slices.Sorted(maps.Keys(counts))
+		for i, letter := range letters {
+			letters[i] = letter + ":" + strconv.Itoa(counts[letter])
+		}
+		writeText(w, strings.Join(letters, ","))
+	}
+}
+
+// NewCitiesHandler возвращает обработчик /cities: отсортированный список
+// городов. С параметром withCounts=true к каждому городу добавляется число кафе.
+func NewCitiesHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		withCounts := req.FormValue("withCounts") == "true"
 
-		for _, v := range cafe {
-			if strings.Contains(strings.ToLower(v), strings.ToLower(search)) {
-				found = append(found, v)
+		cities := store.Cities()
+		counts := make(map[string]int, len(cities))
+		for _, city := range cities {
+			cafe, _ := store.Cafes(city)
+			counts[city] = len(cafe)
+		}
+
+		if acceptsJSON(req) {
+			if withCounts {
+				writeJSON(w, req, counts)
+			} else {
+				writeJSON(w, req, cities)
+			}
+			return
+		}
+		if withCounts {
+			for i, city := range cities {
+				cities[i] = city + ":" + strconv.Itoa(counts[city])
 			}
 		}
-		cafe = found
+		writeText(w, strings.Join(cities, ","))
 	}
-	count = min(count, len(cafe))
-	answer := strings.Join(cafe[:count], ",")
-	io.WriteString(w, answer)
+}
+
+// Ограничения числа подсказок /autocomplete.
+const (
+	defaultAutocompleteLimit = 10
+	maxAutocompleteLimit     = 50
+)
+
+// NewAutocompleteHandler возвращает обработчик /autocomplete: до limit
+// названий кафе города city, начинающихся с prefix, по алфавиту.
+// Пустой prefix возвращает первые limit кафе города.
+func NewAutocompleteHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		limit := defaultAutocompleteLimit
+		if limitStr := req.FormValue("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 0 {
+				writeError(w, req, http.StatusBadRequest, "incorrect limit")
+				return
+			}
+		}
+		limit = min(limit, maxAutocompleteLimit)
+
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := findByPrefix(store, city, strings.TrimSpace(req.FormValue("prefix")))
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		sortCafes(cafe, "name")
+		cafe = cafe[:min(limit, len(cafe))]
+
+		if acceptsJSON(req) {
+			if cafe == nil {
+				cafe = []string{}
+			}
+			writeJSON(w, req, cafe)
+			return
+		}
+		writeText(w, strings.Join(cafe, ","))
+	}
+}
+
+// NewTagsHandler возвращает обработчик /tags: метки кафе города city
+// в нижнем регистре без повторов с числом кафе у каждой — объект в JSON
+// и отсортированный список tag:count в тексте. С параметром
+// withCounts=false отдаются только сами метки.
+// Метки считаются по текущим данным, поэтому сразу отражают перезагрузку.
+func NewTagsHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		withCounts := req.FormValue("withCounts") != "false"
+
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, ok := store.Details(city)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		counts := make(map[string]int)
+		for _, c := range cafe {
+			seen := make(map[string]bool, len(c.Tags))
+			for _, tag := range c.Tags {
+				// метка, повторённая у одного кафе в разном регистре, считается один раз
+				if tag = strings.ToLower(tag); !seen[tag] {
+					seen[tag] = true
+					counts[tag]++
+				}
+			}
+		}
+		tags := slices.Sorted(maps.Keys(counts))
+		if tags == nil {
+			tags = []string{}
+		}
+
+		if acceptsJSON(req) {
+			if withCounts {
+				writeJSON(w, req, counts)
+			} else {
+				writeJSON(w, req, tags)
+			}
+			return
+		}
+		if withCounts {
+			for i, tag := range tags {
+				tags[i] = tag + ":" + strconv.Itoa(counts[tag])
+			}
+		}
+		writeText(w, strings.Join(tags, ","))
+	}
+}
+
+// NewHealthHandler возвращает обработчик /healthz: 200 ok, если в store
+// загружен хотя бы один город, иначе 503 not ready.
+func NewHealthHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if len(store.Cities()) == 0 {
+			writeError(w, req, http.StatusServiceUnavailable, "not ready")
+			return
+		}
+		writeText(w, "ok")
+	}
+}
+
+// notFoundHandle отвечает 404 not found на запросы к неизвестным адресам
+// так же, как остальные ошибки API: текстом или JSON.
+func notFoundHandle(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, http.StatusNotFound, "not found")
+}
+
+// apiVersion — префикс текущей версии API.
+const apiVersion = "/v1"
+
+// deprecatedHandler помечает ответы next заголовком Warning
+// с адресом, который следует использовать вместо устаревшего.
+func deprecatedHandler(next http.Handler, replacement string) http.Handler {
+	warning := `299 - "Deprecated API: use ` + replacement + `"`
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Warning", warning)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// fatal пишет msg в журнал на уровне error и завершает программу.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func main() {
-	http.HandleFunc(`/cafe`, mainHandle)
-	err := http.ListenAndServe(":8080", nil)
+	cfg := configFromEnv()
+	// через журнал по умолчанию пишут и перечитывание данных, и пакет log
+	logger := newLogger(os.Stderr, cfg)
+	slog.SetDefault(logger)
+
+	// без CAFE_DATA используются встроенные данные cafeList;
+	// CAFE_DATA — файлы или каталоги через запятую
+	store := defaultStore
+	if cfg.DataPaths != "" {
+		cities, err := loadData(cfg.DataPaths)
+		if err != nil {
+			fatal("cannot load cafe data", "err", err)
+		}
+		store = NewMemoryStoreFromCities(cities)
+
+		// по SIGHUP данные перечитываются без перезапуска
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go reloadOnSignal(store, cfg.DataPaths, hup)
+	}
+
+	if err := validateAddr(cfg.Addr); err != nil {
+		fatal("incorrect ADDR", "err", err)
+	}
+	// сертификат проверяется до того, как занять порт
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		fatal("cannot load TLS certificate", "err", err)
+	}
+	server := NewServer(store, cfg, logger, prometheus.DefaultRegisterer)
+	tp, err := newTracerProvider(context.Background())
+	if err != nil {
+		fatal("cannot set up tracing", "err", err)
+	}
+	if tp != nil {
+		server.tracer = tp.Tracer(tracerName)
+		// недовыгруженные спаны отправляются при остановке
+		defer tp.Shutdown(context.Background())
+	}
+	if server.limiter != nil {
+		go server.limiter.runSweeper(time.Minute, nil)
+	}
+	srv := &http.Server{Addr: cfg.Addr, Handler: server.Routes()}
+	ln, err := net.Listen("tcp", srv.Addr)
 	if err != nil {
-		panic(err)
+		fatal("cannot listen", "addr", srv.Addr, "err", err)
+	}
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, srv, ln); err != nil {
+		fatal("serve", "err", err)
+	}
+}
+
+// shutdownTimeout — сколько ждать завершения начатых запросов при остановке.
+const shutdownTimeout = 10 * time.Second
+
+// serve обслуживает запросы srv на ln до отмены ctx, затем дожидается
+// завершения начатых запросов, но не дольше shutdownTimeout.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
 	}
+	slog.Info("shutdown complete")
+	return nil
 }
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestCafeNegative tests various negative scenarios for the cafe handler.
@@ -30,6 +40,7 @@ func TestCafeNegative(t *testing.T) {
 		{"/cafe", http.StatusBadRequest, "unknown city"},
 		{"/cafe?city=omsk", http.StatusBadRequest, "unknown city"},
 		{"/cafe?city=tula&count=na", http.StatusBadRequest, "incorrect count"},
+		{"/cafe?city=tula&count=-2", http.StatusBadRequest, "incorrect count"},
 	}
 	for _, v := range requests {
 		response := httptest.NewRecorder()
@@ -71,6 +82,7 @@ func TestCafeCount(t *testing.T) {
 		{1, 1},                         // count=1 — одно кафе
 		{2, 2},                         // count=2 — два кафе
 		{100, len(cafeList["moscow"])}, // count=100 — максимум из общих кафе Москвы
+		{-1, len(cafeList["moscow"])},  // count=-1 — все кафе Москвы
 	}
 
 	for _, v := range requests {
@@ -136,3 +148,1762 @@ func TestCafeSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestCafeJSON(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string   // запрос
+		want    []string // ожидаемый список кафе
+	}{
+		{"/cafe?city=moscow&count=2", []string{"Мир кофе", "Сладкоежка"}},
+		{"/cafe?city=moscow&search=кофе", []string{"Мир кофе", "Кофе и завтраки"}},
+		{"/cafe?city=moscow&search=фасоль", []string{}},
+		{"/cafe?city=tula&count=0", []string{}},
+	}
+
+	for _, v := range requests {
+		t.Run(v.request, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", v.request, nil)
+			req.Header.Set("Accept", "application/json")
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+
+			var cafes []Cafe
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &cafes))
+			assert.NotNil(t, cafes, "empty result must be [], not null")
+			assert.Equal(t, v.want, cafeNames(cafes))
+		})
+	}
+}
+
+func TestCafePlainTextByDefault(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	for _, accept := range []string{"", "text/plain"} {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=moscow&count=2", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "Мир кофе,Сладкоежка", response.Body.String())
+	}
+}
+
+func TestCafeAdd(t *testing.T) {
+	handler := NewHandler(NewMemoryStore(cafeList))
+
+	requests := []struct {
+		request string
+		body    string
+		status  int
+		message string
+	}{
+		{"/cafe?city=moscow", `{"name":"Новое кафе"}`, http.StatusCreated, ""},
+		{"/cafe?city=omsk", `{"name":"Новое кафе"}`, http.StatusBadRequest, "unknown city"},
+		{"/cafe?city=moscow", `{"name":"  "}`, http.StatusBadRequest, "incorrect name"},
+		{"/cafe?city=moscow", `{}`, http.StatusBadRequest, "incorrect name"},
+		{"/cafe?city=moscow", `name`, http.StatusBadRequest, "incorrect name"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", v.request, strings.NewReader(v.body))
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()))
+	}
+
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/cafe?city=moscow&search=новое", nil)
+	handler.ServeHTTP(response, req)
+	assert.Equal(t, "Новое кафе", response.Body.String())
+}
+
+func TestCafeAddConcurrent(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	handler := NewHandler(store)
+
+	const n = 50
+	before := len(cafeList["tula"])
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"Кафе %d"}`, i)
+			req := httptest.NewRequest("POST", "/cafe?city=tula", strings.NewReader(body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}(i)
+	}
+	wg.Wait()
+
+	cafe, _ := store.Cafes("tula")
+	assert.Len(t, cafe, before+n)
+}
+
+func TestCafeDelete(t *testing.T) {
+	store := NewMemoryStore(cafeList)
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		status  int
+		message string
+	}{
+		{"/cafe?city=tula&name=поздний%20ЗАВТРАК", http.StatusNoContent, ""},
+		{"/cafe?city=tula&name=Поздний%20завтрак", http.StatusNotFound, "cafe not found"},
+		{"/cafe?city=tula&name=Дубок", http.StatusNotFound, "cafe not found"},
+		{"/cafe?city=omsk&name=Дубок", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()))
+	}
+
+	cafe, _ := store.Cafes("tula")
+	assert.Equal(t, []string{"Пир и мир", "Красиво есть не запретишь"}, cafe)
+}
+
+func TestCities(t *testing.T) {
+	handler := NewCitiesHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		accept  string
+		want    string
+	}{
+		{"/cities", "", "moscow,tula"},
+		{"/cities?withCounts=true", "", "moscow:5,tula:3"},
+		{"/cities", "application/json", `["moscow","tula"]`},
+		{"/cities?withCounts=true", "application/json", `{"moscow":5,"tula":3}`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept", v.accept)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeCityCaseInsensitive(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=Moscow&count=1", http.StatusOK, "Мир кофе"},
+		{"/cafe?city=MOSCOW&count=1", http.StatusOK, "Мир кофе"},
+		{"/cafe?city=%20TuLa%20&count=1", http.StatusOK, "Пир и мир"},
+		{"/cafe?city=OMSK", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestCafeCityAliases(t *testing.T) {
+	store := NewMemoryStoreFromCities(map[string]City{
+		"moscow": {Aliases: []string{"москва", "msk"}, Cafes: cafesFromNames(cafeList)["moscow"]},
+		"tula":   {Aliases: []string{"тула"}, Cafes: cafesFromNames(cafeList)["tula"]},
+	})
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		status  int
+		city    string
+		want    string
+	}{
+		{"/cafe?city=москва&count=2", http.StatusOK, "moscow", "Мир кофе,Сладкоежка"},
+		{"/cafe?city=%20МОСКВА%20&count=2", http.StatusOK, "moscow", "Мир кофе,Сладкоежка"},
+		{"/cafe?city=msk&search=вилка", http.StatusOK, "moscow", "Ложка и вилка"},
+		{"/cafe?city=тула,tula&count=1", http.StatusOK, "tula", "Пир и мир"},
+		{"/cafe?city=мск", http.StatusBadRequest, "", "unknown city"},
+		{"/cafe?city=питер", http.StatusBadRequest, "", "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.city, response.Header().Get("X-Cafe-City"), v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	// после перезагрузки без другого названия оно перестаёт работать
+	store.ReplaceCities(map[string]City{"moscow": {Cafes: cafesFromNames(cafeList)["moscow"]}})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=москва", nil))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestCafeSearchDecoding(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&search=%20кофе%20", "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=" + url.QueryEscape("  вилка "), "Ложка и вилка"},
+		{"/cafe?city=moscow&search=%D0%BB%D0%BE%D0%B6%D0%BA%D0%B0", "Ложка и вилка"},
+		{"/cafe?city=tula&search=%20%20", "Пир и мир,Красиво есть не запретишь,Поздний завтрак"},
+		{"/cafe?city=tula&search=%20&count=1", "Пир и мир"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeSearchKeepsCase(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&search=мир", "Мир кофе"},
+		{"/cafe?city=moscow&search=МИР", "Мир кофе"},
+		{"/cafe?city=moscow&search=мир&fold=true", "Мир кофе"},
+		{"/cafe?city=moscow&search=мир&mode=prefix", "Мир кофе"},
+		{"/cafe?city=moscow&search=мир&format=json", `[{"name":"Мир кофе"}]`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		// названия отдаются в том виде, в каком хранятся, а не приведёнными к нижнему регистру
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeExclude(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&exclude=кофе", "Сладкоежка,Сытый студент,Ложка и вилка"},
+		{"/cafe?city=moscow&exclude=КОФЕ&exclude=вилка", "Сладкоежка,Сытый студент"},
+		{"/cafe?city=moscow&search=кофе&exclude=мир", "Кофе и завтраки"},
+		{"/cafe?city=moscow&search=кофе&exclude=кофе", ""},
+		{"/cafe?city=moscow&exclude=%20", "Мир кофе,Сладкоежка,Кофе и завтраки,Сытый студент,Ложка и вилка"},
+		{"/cafe?city=tula&exclude=мир&count=1", "Красиво есть не запретишь"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestCafeRegex(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowRegex = true
+	handler := newCafeHandler(defaultStore, cfg)
+
+	requests := []struct {
+		search string
+		status int
+		want   string
+	}{
+		{"^кофе", http.StatusOK, "Кофе и завтраки"},
+		{"^(мир|пир) ", http.StatusOK, "Мир кофе"},
+		{"и (завтраки|вилка)$", http.StatusOK, "Кофе и завтраки,Ложка и вилка"},
+		{"с.т", http.StatusOK, "Сытый студент"},
+		{"к{2,}", http.StatusOK, ""},
+		{"кофе(", http.StatusBadRequest, "invalid regex"},
+		{strings.Repeat("к", maxRegexLen/2+1), http.StatusBadRequest, "regex too long"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=moscow&regex=true&search="+url.QueryEscape(v.search), nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.search)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.search)
+	}
+
+	// без CAFE_ALLOW_REGEX=1 регулярные выражения запрещены
+	response := httptest.NewRecorder()
+	http.HandlerFunc(mainHandle).ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=moscow&regex=true&search=^кофе", nil))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "regex not allowed", strings.TrimSpace(response.Body.String()))
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=moscow&regex=yes", nil))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestCafeMinResults(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowRegex = true
+	handler := newCafeHandler(mockStore{"kazan": {"Кофейня у Кремля", "Мир кофе", "Кофейни", "Чак-чак", "Эчпочмак"}}, cfg)
+
+	requests := []struct {
+		request  string
+		status   int
+		strategy string
+		want     string
+	}{
+		{"search=кофейня", http.StatusOK, "", "Кофейня у Кремля"},
+		{"search=кофейня&minResults=1", http.StatusOK, "exact", "Кофейня у Кремля"},
+		// «кофе» — начало искомой строки
+		{"search=кофейня&minResults=2", http.StatusOK, "prefix", "Кофейня у Кремля,Мир кофе"},
+		{"search=кофейня&minResults=3", http.StatusOK, "fuzzy", "Кофейня у Кремля,Мир кофе,Кофейни"},
+		{"search=кофейня&minResults=4", http.StatusOK, "all", "Кофейня у Кремля,Мир кофе,Кофейни,Чак-чак,Эчпочмак"},
+		// исключения действуют при любом варианте поиска
+		{"search=кофейня&exclude=чак&minResults=10", http.StatusOK, "all", "Кофейня у Кремля,Мир кофе,Кофейни,Эчпочмак"},
+		{"search=^Чак&regex=true&minResults=2", http.StatusOK, "all", "Кофейня у Кремля,Мир кофе,Кофейни,Чак-чак,Эчпочмак"},
+		{"minResults=10", http.StatusOK, "exact", "Кофейня у Кремля,Мир кофе,Кофейни,Чак-чак,Эчпочмак"},
+		{"search=кофейня&minResults=-1", http.StatusBadRequest, "", "incorrect minResults"},
+		{"search=кофейня&minResults=много", http.StatusBadRequest, "", "incorrect minResults"},
+		// prefix сохраняет режим поиска и добавляет слова, начинающиеся с искомой строки
+		{"search=кофе&wholeWord=true&minResults=2", http.StatusOK, "prefix", "Кофейня у Кремля,Мир кофе,Кофейни"},
+		{"search=кофе&mode=prefix&minResults=3", http.StatusOK, "prefix", "Кофейня у Кремля,Мир кофе,Кофейни"},
+		{"search=кремл&wholeWord=true&minResults=1", http.StatusOK, "prefix", "Кофейня у Кремля"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=kazan&"+v.request, nil))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.strategy, response.Header().Get("X-Match-Strategy"), v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeSort(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=tula", http.StatusOK, "Пир и мир,Красиво есть не запретишь,Поздний завтрак"},
+		{"/cafe?city=tula&sort=name", http.StatusOK, "Красиво есть не запретишь,Пир и мир,Поздний завтрак"},
+		{"/cafe?city=tula&sort=name_desc", http.StatusOK, "Поздний завтрак,Пир и мир,Красиво есть не запретишь"},
+		{"/cafe?city=moscow&sort=name&count=2", http.StatusOK, "Кофе и завтраки,Ложка и вилка"},
+		{"/cafe?city=moscow&sort=name&search=кофе&count=1", http.StatusOK, "Кофе и завтраки"},
+		{"/cafe?city=moscow&sort=rank", http.StatusBadRequest, "incorrect sort"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestCafeRandom(t *testing.T) {
+	handler := NewRandomHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		status  int
+		message string
+	}{
+		{"/cafe/random?city=omsk", http.StatusBadRequest, "unknown city"},
+		{"/cafe/random?city=moscow&search=фасоль", http.StatusNotFound, "no matches"},
+		{"/cafe/random?city=moscow&seed=abc", http.StatusBadRequest, "incorrect seed"},
+		{"/cafe/random?city=moscow&search=вилка", http.StatusOK, "Ложка и вилка"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()))
+	}
+
+	t.Run("search", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/cafe/random?city=moscow&search=кофе", nil)
+			handler.ServeHTTP(response, req)
+
+			assert.Contains(t, []string{"Мир кофе", "Кофе и завтраки"}, response.Body.String())
+		}
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		var first string
+		for i := 0; i < 10; i++ {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/cafe/random?city=moscow&seed=42", nil)
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			if i == 0 {
+				first = response.Body.String()
+			}
+			assert.Equal(t, first, response.Body.String())
+		}
+		assert.Contains(t, cafeList["moscow"], first)
+	})
+}
+
+func TestCafeRandomAllCities(t *testing.T) {
+	handler := NewRandomHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		accept  string
+		status  int
+		want    string
+	}{
+		{"/cafe/random?search=запрет", "", http.StatusOK, "Красиво есть не запретишь"},
+		{"/cafe/random?search=запрет", "application/json", http.StatusOK, `{"city":"tula","name":"Красиво есть не запретишь"}`},
+		{"/cafe/random?search=студент&format=json", "", http.StatusOK, `{"city":"moscow","name":"Сытый студент"}`},
+		{"/cafe/random?search=фасоль", "", http.StatusNotFound, "no matches"},
+		{"/cafe/random?search=фасоль", "application/json", http.StatusNotFound, `{"error":"no matches"}`},
+		{"/cafe/random?seed=abc", "", http.StatusBadRequest, "incorrect seed"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		if v.accept != "" {
+			req.Header.Set("Accept", v.accept)
+		}
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	t.Run("search", func(t *testing.T) {
+		// «мир» есть в названиях кафе обоих городов
+		want := map[string]string{"Мир кофе": "moscow", "Пир и мир": "tula"}
+		seen := map[string]bool{}
+		for seed := 0; seed < 50; seed++ {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe/random?search=мир&seed="+strconv.Itoa(seed), nil))
+
+			require.Equal(t, http.StatusOK, response.Code)
+			name := response.Body.String()
+			require.Contains(t, want, name)
+			assert.Equal(t, want[name], response.Header().Get("X-Cafe-City"), name)
+			seen[name] = true
+		}
+		assert.Len(t, seen, 2)
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		var first string
+		for i := 0; i < 10; i++ {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe/random?seed=42&format=json", nil))
+
+			require.Equal(t, http.StatusOK, response.Code)
+			if i == 0 {
+				first = response.Body.String()
+			}
+			assert.Equal(t, first, response.Body.String())
+		}
+		var picked struct{ City, Name string }
+		require.NoError(t, json.Unmarshal([]byte(first), &picked))
+		assert.Contains(t, cafeList[picked.City], picked.Name)
+	})
+}
+
+func TestCafeRandomSeedConfig(t *testing.T) {
+	seed := int64(7)
+	cfg := DefaultConfig()
+	cfg.RandomSeed = &seed
+	logger := slog.New(slog.DiscardHandler)
+
+	// последовательность ответов сервера определяется CAFE_RANDOM_SEED
+	sequence := func() []string {
+		mux := NewServer(defaultStore, cfg, logger, nil).mux()
+		var names []string
+		for i := 0; i < 10; i++ {
+			response := httptest.NewRecorder()
+			mux.ServeHTTP(response, httptest.NewRequest("GET", "/v1/cafe/random?city=moscow", nil))
+			require.Equal(t, http.StatusOK, response.Code)
+			names = append(names, response.Body.String())
+		}
+		return names
+	}
+	first := sequence()
+	assert.Equal(t, first, sequence())
+	assert.Greater(t, len(slices.Compact(slices.Clone(first))), 1, "ответы не должны повторять одно кафе")
+
+	// seed запроса важнее общего генератора
+	mux := NewServer(defaultStore, cfg, logger, nil).mux()
+	for i := 0; i < 3; i++ {
+		seeded := httptest.NewRecorder()
+		mux.ServeHTTP(seeded, httptest.NewRequest("GET", "/v1/cafe/random?city=moscow&seed=42", nil))
+		want := httptest.NewRecorder()
+		NewRandomHandler(defaultStore).ServeHTTP(want, httptest.NewRequest("GET", "/cafe/random?city=moscow&seed=42", nil))
+		assert.Equal(t, want.Body.String(), seeded.Body.String())
+	}
+
+	// общий генератор можно использовать из нескольких запросов сразу
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := httptest.NewRecorder()
+			mux.ServeHTTP(response, httptest.NewRequest("GET", "/v1/cafe/random?city=moscow&weighted=true", nil))
+			assert.Equal(t, http.StatusOK, response.Code)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCafeRandomWeighted(t *testing.T) {
+	rating := func(v float64) *float64 { return &v }
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{
+		"kazan": {
+			{Name: "Чак-чак", Rating: rating(5)},
+			{Name: "Эчпочмак", Rating: rating(0)},
+			{Name: "Бахетле"},
+		},
+		"tula": {{Name: "Пир и мир", Rating: rating(0)}, {Name: "Поздний завтрак", Rating: rating(0)}},
+	})
+	handler := NewRandomHandler(store)
+
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/cafe/random?city=kazan&weighted=true&seed=%d", i), nil)
+		handler.ServeHTTP(response, req)
+
+		require.Equal(t, http.StatusOK, response.Code)
+		counts[response.Body.String()]++
+	}
+	// кафе с нулевой оценкой не выпадает, без оценки — выпадает редко
+	assert.Zero(t, counts["Эчпочмак"])
+	assert.Positive(t, counts["Бахетле"])
+	assert.Greater(t, counts["Чак-чак"], 5*counts["Бахетле"])
+
+	// при одинаковом seed выбор повторяется
+	do := func(target string) string {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", target, nil))
+		return response.Body.String()
+	}
+	first := do("/cafe/random?city=kazan&weighted=true&seed=7")
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, do("/cafe/random?city=kazan&weighted=true&seed=7"))
+	}
+
+	// если у всех кафе нулевой вес, подходит любое
+	assert.Contains(t, []string{"Пир и мир", "Поздний завтрак"}, do("/cafe/random?city=tula&weighted=true"))
+}
+
+func TestCafeContentType(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+	}{
+		{"/cafe?city=moscow", http.StatusOK},
+		{"/cafe?city=omsk", http.StatusBadRequest},
+		{"/cafe?city=moscow&count=na", http.StatusBadRequest},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	}
+}
+
+func TestCafeTotalCount(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    int
+	}{
+		{"/cafe?city=moscow", len(cafeList["moscow"])},
+		{"/cafe?city=moscow&count=2", len(cafeList["moscow"])},
+		{"/cafe?city=moscow&count=0", len(cafeList["moscow"])},
+		{"/cafe?city=moscow&search=кофе&count=1", 2},
+		{"/cafe?city=moscow&search=фасоль", 0},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, strconv.Itoa(v.want), response.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestCafePageHeaders(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		page    string
+		perPage string
+		pages   string
+	}{
+		{"/cafe?city=moscow&count=2", "1", "2", "3"},
+		{"/cafe?city=moscow&count=2&offset=2", "2", "2", "3"},
+		{"/cafe?city=moscow&count=2&offset=3", "2", "2", "3"},
+		{"/cafe?city=moscow&count=2&offset=4", "3", "2", "3"},
+		{"/cafe?city=moscow&count=5", "1", "5", "1"},
+		{"/cafe?city=moscow&count=-1", "1", "5", "1"},
+		{"/cafe?city=moscow&count=all", "1", "5", "1"},
+		{"/cafe?city=moscow&count=0", "1", "0", "1"},
+		{"/cafe?city=moscow&search=фасоль&count=2", "1", "2", "1"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, v.page, response.Header().Get("X-Page"), v.request)
+		assert.Equal(t, v.perPage, response.Header().Get("X-Per-Page"), v.request)
+		assert.Equal(t, v.pages, response.Header().Get("X-Total-Pages"), v.request)
+	}
+}
+
+func TestCafeLinkHeaders(t *testing.T) {
+	handler := newMux(NewMemoryStore(cafeList))
+
+	requests := []struct {
+		request string
+		want    []string
+	}{
+		{"/v1/cafe?city=moscow&count=2", []string{
+			`</v1/cafe?city=moscow&count=2&offset=2>; rel="next"`,
+		}},
+		{"/v1/cafe?city=moscow&count=2&offset=2&sort=name&search=%20", []string{
+			`</v1/cafe?city=moscow&count=2&offset=4&search=+&sort=name>; rel="next"`,
+			`</v1/cafe?city=moscow&count=2&offset=0&search=+&sort=name>; rel="prev"`,
+		}},
+		{"/v1/cafe?city=moscow&count=2&offset=1", []string{
+			`</v1/cafe?city=moscow&count=2&offset=3>; rel="next"`,
+			`</v1/cafe?city=moscow&count=2&offset=0>; rel="prev"`,
+		}},
+		{"/v1/cafe?city=moscow&count=2&offset=4", []string{
+			`</v1/cafe?city=moscow&count=2&offset=2>; rel="prev"`,
+		}},
+		{"/cafe?city=moscow&count=3&offset=3", []string{
+			`</cafe?city=moscow&count=3&offset=0>; rel="prev"`,
+		}},
+		{"/v1/cafe?city=moscow", nil},
+		{"/v1/cafe?city=moscow&count=-1&offset=1", nil},
+		{"/v1/cafe?city=moscow&count=0", nil},
+	}
+	for _, v := range requests {
+		// запрос повторяется, чтобы проверить и ответ из кеша
+		for i := 0; i < 2; i++ {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", v.request, nil)
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, v.want, response.Header().Values("Link"), v.request)
+		}
+	}
+}
+
+func TestCafeCityHeader(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow", "moscow"},
+		{"/cafe?city=%20MosCow%20&format=json", "moscow"},
+		{"/cafe?city=Tula,moscow,tula", "tula,moscow"},
+		{"/cafe?city=moscow&search=фасоль", "moscow"},
+		{"/cafe?city=omsk", ""},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.want, response.Header().Get("X-Cafe-City"), v.request)
+	}
+}
+
+func TestCafeStrictParams(t *testing.T) {
+	requests := []struct {
+		request string
+		strict  bool
+		status  int
+		message string
+	}{
+		{"/cafe?citi=moscow", false, http.StatusBadRequest, "unknown city"},
+		{"/cafe?citi=moscow", true, http.StatusBadRequest, "unknown parameter: citi"},
+		{"/cafe?city=moscow&count=1&limit=2", true, http.StatusBadRequest, "unknown parameter: limit"},
+		{"/cafe?city=moscow&count=1&search=мир&sort=name", true, http.StatusOK, "Мир кофе"},
+	}
+	for _, v := range requests {
+		cfg := DefaultConfig()
+		cfg.StrictParams = v.strict
+		handler := newCafeHandler(defaultStore, cfg)
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestCafeOffset(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&offset=2&count=2", http.StatusOK, "Кофе и завтраки,Сытый студент"},
+		{"/cafe?city=moscow&offset=4", http.StatusOK, "Ложка и вилка"},
+		{"/cafe?city=moscow&offset=5", http.StatusOK, ""},
+		{"/cafe?city=moscow&offset=100&count=2", http.StatusOK, ""},
+		{"/cafe?city=moscow&search=кофе&offset=1", http.StatusOK, "Кофе и завтраки"},
+		{"/cafe?city=moscow&sort=name&offset=1&count=1", http.StatusOK, "Ложка и вилка"},
+		{"/cafe?city=moscow&offset=na", http.StatusBadRequest, "incorrect offset"},
+		{"/cafe?city=moscow&offset=-1", http.StatusBadRequest, "incorrect offset"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	requests := []struct {
+		store   CafeStore
+		status  int
+		message string
+	}{
+		{defaultStore, http.StatusOK, "ok"},
+		{NewMemoryStore(nil), http.StatusServiceUnavailable, "not ready"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthz?city=omsk&count=na", nil)
+		newMux(v.store).ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestCafeMethodNotAllowed(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	for _, method := range []string{"PUT", "PATCH"} {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/cafe?city=moscow", nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+		assert.Equal(t, "GET, HEAD, POST, DELETE", response.Header().Get("Allow"))
+		assert.Equal(t, "method not allowed", strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	names := make([]string, 0, 60)
+	for i := 0; i < 60; i++ {
+		names = append(names, fmt.Sprintf("Кафе %02d", i))
+	}
+	handler := NewAutocompleteHandler(NewMemoryStore(map[string][]string{
+		"moscow": cafeList["moscow"],
+		"big":    names,
+	}))
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/autocomplete?city=moscow&prefix=с", http.StatusOK, "Сладкоежка,Сытый студент"},
+		{"/autocomplete?city=moscow&prefix=%20СЫ", http.StatusOK, "Сытый студент"},
+		{"/autocomplete?city=moscow&prefix=с&limit=1", http.StatusOK, "Сладкоежка"},
+		{"/autocomplete?city=moscow&limit=2", http.StatusOK, "Кофе и завтраки,Ложка и вилка"},
+		{"/autocomplete?city=moscow", http.StatusOK, "Кофе и завтраки,Ложка и вилка,Мир кофе,Сладкоежка,Сытый студент"},
+		{"/autocomplete?city=moscow&prefix=фасоль", http.StatusOK, ""},
+		{"/autocomplete?city=omsk&prefix=с", http.StatusBadRequest, "unknown city"},
+		{"/autocomplete?city=moscow&limit=na", http.StatusBadRequest, "incorrect limit"},
+		{"/autocomplete?city=moscow&limit=-1", http.StatusBadRequest, "incorrect limit"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	t.Run("limits", func(t *testing.T) {
+		requests := []struct {
+			request string
+			want    int
+		}{
+			{"/autocomplete?city=big", defaultAutocompleteLimit},
+			{"/autocomplete?city=big&limit=1000", maxAutocompleteLimit},
+		}
+		for _, v := range requests {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", v.request, nil)
+			handler.ServeHTTP(response, req)
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Len(t, strings.Split(response.Body.String(), ","), v.want)
+		}
+	})
+}
+
+func TestCafeDelimiter(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&count=2", http.StatusOK, "Мир кофе,Сладкоежка"},
+		{"/cafe?city=moscow&count=2&delimiter=comma", http.StatusOK, "Мир кофе,Сладкоежка"},
+		{"/cafe?city=moscow&count=2&delimiter=newline", http.StatusOK, "Мир кофе\nСладкоежка"},
+		{"/cafe?city=moscow&count=2&delimiter=semicolon", http.StatusOK, "Мир кофе;Сладкоежка"},
+		{"/cafe?city=moscow&count=2&delimiter=tab", http.StatusOK, "Мир кофе\tСладкоежка"},
+		{"/cafe?city=moscow&count=2&delimiter=pipe", http.StatusBadRequest, "incorrect delimiter\n"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeMaxCount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxCount = 3
+	handler := newCafeHandler(defaultStore, cfg)
+
+	requests := []struct {
+		request string
+		want    int
+	}{
+		{"/cafe?city=moscow&count=2", 2},
+		{"/cafe?city=moscow&count=4", 3},
+		{"/cafe?city=moscow&count=2147483647", 3},
+		{"/cafe?city=moscow", 3},
+		{"/cafe?city=moscow&count=-1", len(cafeList["moscow"])},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Len(t, strings.Split(response.Body.String(), ","), v.want, v.request)
+	}
+}
+
+func TestCafeCountAll(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxCount = 3
+	cfg.DefaultCount = 2
+	handler := newCafeHandler(defaultStore, cfg)
+
+	requests := []struct {
+		request string
+		status  int
+		want    int
+	}{
+		// all, как и -1, не ограничивается ни DefaultCount, ни MaxCount
+		{"/cafe?city=moscow&count=all", http.StatusOK, len(cafeList["moscow"])},
+		{"/cafe?city=moscow&count=ALL", http.StatusOK, len(cafeList["moscow"])},
+		{"/cafe?city=moscow&count=All", http.StatusOK, len(cafeList["moscow"])},
+		{"/cafe?city=moscow&count=1", http.StatusOK, 1},
+		{"/cafe?city=moscow&count=4", http.StatusOK, 3},
+		{"/cafe?city=moscow&count=al", http.StatusBadRequest, 0},
+		{"/cafe?city=moscow&count=all1", http.StatusBadRequest, 0},
+		{"/cafe?city=moscow&count=-2", http.StatusBadRequest, 0},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", v.request, nil))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		if v.status != http.StatusOK {
+			assert.Equal(t, "incorrect count", strings.TrimSpace(response.Body.String()), v.request)
+			continue
+		}
+		assert.Len(t, strings.Split(response.Body.String(), ","), v.want, v.request)
+	}
+
+	// с offset all отдаёт все оставшиеся кафе одной страницей
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=moscow&count=all&offset=2", nil))
+	assert.Len(t, strings.Split(response.Body.String(), ","), len(cafeList["moscow"])-2)
+	assert.Equal(t, "1", response.Header().Get("X-Total-Pages"))
+}
+
+func TestCafeDefaultCount(t *testing.T) {
+	requests := []struct {
+		defaultCount int
+		maxCount     int
+		request      string
+		want         int
+	}{
+		{2, 1000, "/cafe?city=moscow", 2},
+		{2, 1000, "/cafe?city=moscow&count=4", 4},
+		{2, 1000, "/cafe?city=moscow&count=-1", len(cafeList["moscow"])},
+		{0, 1000, "/cafe?city=moscow", len(cafeList["moscow"])},
+		{0, 3, "/cafe?city=moscow", len(cafeList["moscow"])},
+		{4, 3, "/cafe?city=moscow", 3},
+	}
+	for _, v := range requests {
+		cfg := DefaultConfig()
+		cfg.DefaultCount = v.defaultCount
+		cfg.MaxCount = v.maxCount
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		newCafeHandler(defaultStore, cfg).ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Len(t, strings.Split(response.Body.String(), ","), v.want, "%d %s", v.defaultCount, v.request)
+	}
+}
+
+func TestCafeMaxSearchLen(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxSearchLen = 5
+	handler := newCafeHandler(defaultStore, cfg)
+
+	requests := []struct {
+		search string
+		status int
+	}{
+		{"кофе", http.StatusOK},
+		{"вилка", http.StatusOK}, // 5 рун, но 10 байт
+		{"ложкаи", http.StatusBadRequest},
+		{"coffee", http.StatusBadRequest},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=moscow&search="+url.QueryEscape(v.search), nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.search)
+		if v.status == http.StatusBadRequest {
+			assert.Equal(t, "search too long", strings.TrimSpace(response.Body.String()))
+		}
+	}
+
+	cfg.MaxSearchLen = 0
+	handler = newCafeHandler(defaultStore, cfg)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=moscow&search="+strings.Repeat("к", 1000), nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestCafeJSONErrors(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		method  string
+		request string
+		status  int
+		message string
+	}{
+		{"GET", "/cafe?city=omsk", http.StatusBadRequest, "unknown city"},
+		{"GET", "/cafe?city=tula&count=na", http.StatusBadRequest, "incorrect count"},
+		{"DELETE", "/cafe?city=tula&name=Дубок", http.StatusNotFound, "cafe not found"},
+		{"PUT", "/cafe?city=tula", http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, v.request, nil)
+		req.Header.Set("Accept", "application/json")
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"`+v.message+`"}`, response.Body.String())
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &http.Server{Handler: mux}, ln)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		got <- result{string(body), err}
+	}()
+
+	// остановка начинается, пока запрос ещё обрабатывается
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	r := <-got
+	require.NoError(t, r.err)
+	assert.Equal(t, "done", r.body)
+	assert.NoError(t, <-served)
+
+	_, err = http.Get("http://" + ln.Addr().String() + "/slow")
+	assert.Error(t, err, "server must not accept connections after shutdown")
+}
+
+func TestCafeFields(t *testing.T) {
+	rating := 4.5
+	store := NewMemoryStoreFromCities(map[string]City{
+		"kazan": {Cafes: []Cafe{
+			{Name: "Чак-чак", Rating: &rating, Tags: []string{"dessert"}, Location: &Point{Lat: 55.79, Lon: 49.12}},
+			{Name: "Эчпочмак", Tags: []string{"bakery"}},
+		}},
+		"tula": {Cafes: []Cafe{{Name: "Пир и мир", Rating: &rating}}},
+	})
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=kazan&format=json&fields=name,rating", http.StatusOK, `[{"name":"Чак-чак","rating":4.5},{"name":"Эчпочмак"}]`},
+		// name отдаётся, даже если его не просили
+		{"/cafe?city=kazan&format=json&fields=tags", http.StatusOK, `[{"name":"Чак-чак","tags":["dessert"]},{"name":"Эчпочмак","tags":["bakery"]}]`},
+		{"/cafe?city=kazan&format=json&fields=location,%20,name", http.StatusOK, `[{"location":{"lat":55.79,"lon":49.12},"name":"Чак-чак"},{"name":"Эчпочмак"}]`},
+		{"/cafe?city=kazan,tula&format=json&fields=rating", http.StatusOK, `{"kazan":[{"name":"Чак-чак","rating":4.5},{"name":"Эчпочмак"}],"tula":[{"name":"Пир и мир","rating":4.5}]}`},
+		{"/cafe?city=kazan&format=json&fields=", http.StatusOK, `[{"name":"Чак-чак","rating":4.5,"tags":["dessert"],"location":{"lat":55.79,"lon":49.12}},{"name":"Эчпочмак","tags":["bakery"]}]`},
+		{"/cafe?city=kazan&fields=rating", http.StatusOK, "Чак-чак,Эчпочмак"},
+		{"/cafe?city=kazan&format=json&fields=name,price", http.StatusBadRequest, `{"error":"unknown field"}`},
+		{"/cafe?city=kazan&format=json&fields=Rating", http.StatusBadRequest, `{"error":"unknown field"}`},
+		{"/cafe?city=kazan&fields=city", http.StatusBadRequest, "unknown field"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", v.request, nil))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafePrettyJSON(t *testing.T) {
+	mux := newMux(NewMemoryStore(cafeList))
+
+	requests := []struct {
+		method  string
+		request string
+		body    string
+		want    string
+	}{
+		{"GET", "/cafe?city=tula&count=1&format=json", "", `[{"name":"Пир и мир"}]`},
+		{"GET", "/cafe?city=tula&count=1&format=json&pretty=true", "", "[\n  {\n    \"name\": \"Пир и мир\"\n  }\n]"},
+		{"GET", "/cafe?city=omsk&format=json", "", `{"error":"unknown city"}`},
+		{"GET", "/cafe?city=omsk&format=json&pretty=true", "", "{\n  \"error\": \"unknown city\"\n}"},
+		{"POST", "/cafe/batch", `[{"city":"tula","count":1}]`, `[{"city":"tula","cafes":[{"name":"Пир и мир"}]}]`},
+		{"POST", "/cafe/batch?pretty=true", `[{"city":"tula","count":1}]`, "[\n  {\n    \"city\": \"tula\",\n    \"cafes\": [\n      {\n        \"name\": \"Пир и мир\"\n      }\n    ]\n  }\n]"},
+		// в тексте pretty ничего не меняет
+		{"GET", "/cafe?city=tula&count=2&pretty=true", "", "Пир и мир,Красиво есть не запретишь"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, httptest.NewRequest(v.method, v.request, strings.NewReader(v.body)))
+
+		// переводы строк есть только в ответах с pretty=true
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeCSV(t *testing.T) {
+	handler := NewHandler(NewMemoryStore(map[string][]string{
+		"moscow": cafeList["moscow"],
+		"tula":   {"Пир и мир", `Кафе "Ёлки, палки"`, "Поздний завтрак"},
+	}))
+
+	requests := []struct {
+		request string
+		accept  string
+		want    string
+	}{
+		{"/cafe?city=moscow&count=2&format=csv", "", "name\r\nМир кофе\r\nСладкоежка\r\n"},
+		{"/cafe?city=moscow&search=кофе", "text/csv", "name\r\nМир кофе\r\nКофе и завтраки\r\n"},
+		{"/cafe?city=moscow&count=0&format=csv", "", "name\r\n"},
+		{"/cafe?city=tula&search=ёлки&format=csv", "", "name\r\n\"Кафе \"\"Ёлки, палки\"\"\"\r\n"},
+		{"/cafe?city=tula&count=1&format=csv", "application/json", "name\r\nПир и мир\r\n"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept", v.accept)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", response.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="cafes.csv"`, response.Header().Get("Content-Disposition"))
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeXML(t *testing.T) {
+	handler := NewHandler(NewMemoryStore(map[string][]string{
+		"moscow": cafeList["moscow"],
+		"tula":   {"Пир & мир", "<Поздний> завтрак"},
+	}))
+
+	requests := []struct {
+		request string
+		accept  string
+		want    string
+	}{
+		{"/cafe?city=moscow&count=2&format=xml", "", "<cafes><cafe>Мир кофе</cafe><cafe>Сладкоежка</cafe></cafes>"},
+		{"/cafe?city=moscow&search=кофе", "application/xml", "<cafes><cafe>Мир кофе</cafe><cafe>Кофе и завтраки</cafe></cafes>"},
+		{"/cafe?city=moscow&count=0&format=xml", "", "<cafes></cafes>"},
+		{"/cafe?city=tula&format=xml", "", "<cafes><cafe>Пир &amp; мир</cafe><cafe>&lt;Поздний&gt; завтрак</cafe></cafes>"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept", v.accept)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/xml; charset=utf-8", response.Header().Get("Content-Type"))
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeFormat(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=tula&count=1&format=text", http.StatusOK, "Пир и мир"},
+		{"/cafe?city=tula&count=1&format=json", http.StatusOK, `[{"name":"Пир и мир"}]`},
+		{"/cafe?city=tula&format=yaml", http.StatusBadRequest, "incorrect format\n"},
+		{"/cafe?city=omsk&format=json", http.StatusBadRequest, `{"error":"unknown city"}`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, response.Body.String())
+	}
+}
+
+func TestCafeLookup(t *testing.T) {
+	handler := NewLookupHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe/lookup?city=moscow&name=Сладкоежка", http.StatusOK, "Сладкоежка"},
+		{"/cafe/lookup?city=moscow&name=мир%20КОФЕ", http.StatusOK, "Мир кофе"},
+		{"/cafe/lookup?city=Tula&name=%20пир%20и%20мир%20", http.StatusOK, "Пир и мир"},
+		{"/cafe/lookup?city=moscow&name=кофе", http.StatusNotFound, "cafe not found in moscow"},
+		{"/cafe/lookup?city=tula&name=Сладкоежка", http.StatusNotFound, "cafe not found in tula"},
+		{"/cafe/lookup?city=omsk&name=Сладкоежка", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeCountEndpoint(t *testing.T) {
+	handler := NewCountHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe/count?city=moscow", http.StatusOK, "5"},
+		{"/cafe/count?city=moscow&search=кофе", http.StatusOK, "2"},
+		{"/cafe/count?city=moscow&search=кофе&count=1&offset=1", http.StatusOK, "2"},
+		{"/cafe/count?city=moscow&search=фасоль", http.StatusOK, "0"},
+		{"/cafe/count?city=Tula&format=json", http.StatusOK, `{"count":3}`},
+		{"/cafe/count?city=omsk", http.StatusBadRequest, "unknown city"},
+		{"/cafe/count?city=moscow&match=some", http.StatusBadRequest, "incorrect match"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeLetterIndex(t *testing.T) {
+	handler := NewIndexHandler(defaultStore)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe/index?city=moscow", http.StatusOK, "К:1,Л:1,М:1,С:2"},
+		{"/cafe/index?city=moscow&format=json", http.StatusOK, `{"К":1,"Л":1,"М":1,"С":2}`},
+		{"/cafe/index?city=moscow&search=кофе", http.StatusOK, "К:1,М:1"},
+		{"/cafe/index?city=moscow&search=фасоль", http.StatusOK, ""},
+		{"/cafe/index?city=moscow&search=фасоль&format=json", http.StatusOK, "{}"},
+		{"/cafe/index?city=Tula", http.StatusOK, "К:1,П:2"},
+		{"/cafe/index?city=omsk", http.StatusBadRequest, "unknown city"},
+		{"/cafe/index?city=moscow&mode=suffix", http.StatusBadRequest, "incorrect mode"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", v.request, nil))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+
+	// строчная первая буква считается вместе с заглавной
+	response := httptest.NewRecorder()
+	NewIndexHandler(mockStore{"kazan": {"эчпочмак", "Эссе", "Чак-чак", "cafe"}}).ServeHTTP(response, httptest.NewRequest("GET", "/cafe/index?city=kazan", nil))
+	assert.Equal(t, "C:1,Ч:1,Э:2", response.Body.String())
+}
+
+func TestCafeMultipleCities(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		accept  string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow,tula&search=мир", "", http.StatusOK, "Мир кофе,Пир и мир"},
+		{"/cafe?city=tula,%20Moscow&search=мир", "", http.StatusOK, "Пир и мир,Мир кофе"},
+		{"/cafe?city=moscow,tula&search=завтрак&count=1", "", http.StatusOK, "Кофе и завтраки"},
+		{"/cafe?city=moscow,tula&search=завтрак&sort=name_desc", "", http.StatusOK, "Поздний завтрак,Кофе и завтраки"},
+		{"/cafe?city=moscow,moscow&search=вилка", "", http.StatusOK, "Ложка и вилка"},
+		{"/cafe?city=moscow,omsk", "", http.StatusBadRequest, "unknown city: omsk\n"},
+		{"/cafe?city=,", "", http.StatusBadRequest, "unknown city\n"},
+		{"/cafe?city=moscow,tula&search=завтрак", "application/json", http.StatusOK,
+			`{"moscow":[{"name":"Кофе и завтраки"}],"tula":[{"name":"Поздний завтрак"}]}`},
+		{"/cafe?city=moscow,tula&search=мир&count=1", "application/json", http.StatusOK,
+			`{"moscow":[{"name":"Мир кофе"}],"tula":[]}`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("Accept", v.accept)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestCitiesDeterministic(t *testing.T) {
+	data := make(map[string][]string)
+	for _, city := range []string{"tula", "moscow", "kazan", "omsk", "perm", "sochi", "ufa", "tver"} {
+		data[city] = []string{"Кафе"}
+	}
+	handler := NewCitiesHandler(NewMemoryStore(data))
+
+	for _, accept := range []string{"", "application/json"} {
+		var first string
+		for i := 0; i < 100; i++ {
+			response := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/cities?withCounts=true", nil)
+			req.Header.Set("Accept", accept)
+			handler.ServeHTTP(response, req)
+
+			if i == 0 {
+				first = response.Body.String()
+				continue
+			}
+			require.Equal(t, first, response.Body.String(), "request %d", i)
+		}
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	mux := newMux(defaultStore)
+
+	requests := []struct {
+		request string
+		warning string
+	}{
+		{"/v1/cafe?city=tula&count=1", ""},
+		{"/cafe?city=tula&count=1", `299 - "Deprecated API: use /v1/cafe"`},
+		{"/v1/cities", ""},
+		{"/cities", `299 - "Deprecated API: use /v1/cities"`},
+		{"/v1/cafe/lookup?city=tula&name=пир%20и%20мир", ""},
+		{"/cafe/lookup?city=tula&name=пир%20и%20мир", `299 - "Deprecated API: use /v1/cafe/lookup"`},
+		{"/v1/stats", ""},
+		{"/stats", `299 - "Deprecated API: use /v1/stats"`},
+		{"/v1/openapi.json", ""},
+		{"/openapi.json", `299 - "Deprecated API: use /v1/openapi.json"`},
+		// служебные адреса не версионируются
+		{"/healthz", ""},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		mux.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.warning, response.Header().Get("Warning"), v.request)
+	}
+
+	// оба адреса отвечают одинаково
+	for _, path := range []string{"/cafe?city=moscow&search=кофе", "/cafe/random?city=moscow&seed=1", "/autocomplete?city=moscow&prefix=с"} {
+		old := httptest.NewRecorder()
+		mux.ServeHTTP(old, httptest.NewRequest("GET", path, nil))
+		v1 := httptest.NewRecorder()
+		mux.ServeHTTP(v1, httptest.NewRequest("GET", "/v1"+path, nil))
+
+		assert.Equal(t, old.Code, v1.Code, path)
+		assert.Equal(t, old.Body.String(), v1.Body.String(), path)
+	}
+}
+
+func TestCafeDuplicateParams(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		message string
+	}{
+		{"/cafe?city=moscow&city=tula", http.StatusBadRequest, "duplicate parameter"},
+		{"/cafe?city=moscow&city=moscow", http.StatusBadRequest, "duplicate parameter"},
+		{"/cafe?city=moscow&count=1&count=2", http.StatusBadRequest, "duplicate parameter"},
+		{"/cafe?city=moscow&search=мир&search=кофе", http.StatusBadRequest, "duplicate parameter"},
+		// несколько городов передаются через запятую
+		{"/cafe?city=moscow,tula&count=1", http.StatusOK, "Мир кофе"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.message, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeCountCanonical(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		count  string
+		status int
+	}{
+		{" 2", http.StatusBadRequest},
+		{"2 ", http.StatusBadRequest},
+		{"+2", http.StatusBadRequest},
+		{"02", http.StatusBadRequest},
+		{"00", http.StatusBadRequest},
+		{"-0", http.StatusBadRequest},
+		{"2.0", http.StatusBadRequest},
+		{"2", http.StatusOK},
+		{"0", http.StatusOK},
+		{"-1", http.StatusOK},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=tula&count="+url.QueryEscape(v.count), nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, "%q", v.count)
+		if v.status == http.StatusBadRequest {
+			assert.Equal(t, "incorrect count", strings.TrimSpace(response.Body.String()))
+		}
+	}
+}
+
+func TestCafeRating(t *testing.T) {
+	rating := func(v float64) *float64 { return &v }
+	handler := NewHandler(NewMemoryStoreFromCafes(map[string][]Cafe{
+		"kazan": {
+			{Name: "Чак-чак", Rating: rating(4.2)},
+			{Name: "Эчпочмак"},
+			{Name: "Кофейня у Кремля", Rating: rating(4.8)},
+			{Name: "Бахетле", Rating: rating(3.9)},
+			{Name: "Пекарня", Rating: rating(4.2)},
+		},
+	}))
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		// при равной оценке кафе идут по названию
+		{"/cafe?city=kazan&sort=rating", http.StatusOK, "Кофейня у Кремля,Пекарня,Чак-чак,Бахетле,Эчпочмак"},
+		{"/cafe?city=kazan&minRating=4.2", http.StatusOK, "Чак-чак,Кофейня у Кремля,Пекарня"},
+		{"/cafe?city=kazan&minRating=0", http.StatusOK, "Чак-чак,Кофейня у Кремля,Бахетле,Пекарня"},
+		{"/cafe?city=kazan&minRating=4.2&sort=rating&count=2", http.StatusOK, "Кофейня у Кремля,Пекарня"},
+		{"/cafe?city=kazan&minRating=5", http.StatusOK, ""},
+		{"/cafe?city=kazan&minRating=high", http.StatusBadRequest, "incorrect minRating\n"},
+		{"/cafe?city=kazan&minRating=-1", http.StatusBadRequest, "incorrect minRating\n"},
+		{"/cafe?city=kazan&minRating=NaN", http.StatusBadRequest, "incorrect minRating\n"},
+		{"/cafe?city=kazan&sort=rating&count=2&format=json", http.StatusOK,
+			`[{"name":"Кофейня у Кремля","rating":4.8},{"name":"Пекарня","rating":4.2}]`},
+		{"/cafe?city=kazan&search=эчпочмак&format=json", http.StatusOK, `[{"name":"Эчпочмак"}]`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestSortByRating(t *testing.T) {
+	rating := func(v float64) *float64 { return &v }
+	items := []cityCafe{
+		{cafe: Cafe{Name: "Чак-чак", Rating: rating(4)}},
+		{cafe: Cafe{Name: "эчпочмак"}},
+		{cafe: Cafe{Name: "Бахетле", Rating: rating(4)}},
+		{cafe: Cafe{Name: "Кофейня", Rating: rating(5)}},
+		{cafe: Cafe{Name: "Азу"}},
+		{cafe: Cafe{Name: "бэлиш", Rating: rating(4)}},
+	}
+	// порядок не зависит от исходного
+	for range 3 {
+		sortByRating(items)
+		var names []string
+		for _, c := range items {
+			names = append(names, c.cafe.Name)
+		}
+		assert.Equal(t, []string{"Кофейня", "Бахетле", "бэлиш", "Чак-чак", "Азу", "эчпочмак"}, names)
+		slices.Reverse(items)
+	}
+}
+
+func TestCafeOpen(t *testing.T) {
+	saved := timeNow
+	t.Cleanup(func() { timeNow = saved })
+	// 23:30 в UTC — 02:30 в Москве
+	timeNow = func() time.Time { return time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC) }
+
+	cafe := []Cafe{
+		{Name: "Чак-чак", Hours: &Hours{Open: 8 * 60, Close: 22 * 60}},
+		{Name: "Эчпочмак"},
+		{Name: "Ночная кофейня", Hours: &Hours{Open: 20 * 60, Close: 2 * 60}},
+		{Name: "Круглосуточная", Hours: &Hours{}},
+	}
+	handler := NewHandler(NewMemoryStoreFromCities(map[string]City{
+		"kazan":  {Cafes: cafe},
+		"moscow": {Timezone: "Europe/Moscow", Cafes: cafe},
+	}))
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=kazan&open=now", http.StatusOK, "Ночная кофейня,Круглосуточная"},
+		{"/cafe?city=kazan&open=now&includeUnknownHours=true", http.StatusOK, "Эчпочмак,Ночная кофейня,Круглосуточная"},
+		{"/cafe?city=moscow&open=now", http.StatusOK, "Круглосуточная"},
+		{"/cafe?city=kazan,moscow&open=now", http.StatusOK, "Ночная кофейня,Круглосуточная,Круглосуточная"},
+		{"/cafe?city=kazan&at=12:00", http.StatusOK, "Чак-чак,Круглосуточная"},
+		{"/cafe?city=kazan&at=01:15", http.StatusOK, "Ночная кофейня,Круглосуточная"},
+		{"/cafe?city=kazan&at=21:00", http.StatusOK, "Чак-чак,Ночная кофейня,Круглосуточная"},
+		{"/cafe?city=kazan&includeUnknownHours=true", http.StatusOK, "Чак-чак,Эчпочмак,Ночная кофейня,Круглосуточная"},
+		{"/cafe?city=kazan&open=tomorrow", http.StatusBadRequest, "incorrect open\n"},
+		{"/cafe?city=kazan&at=25:00", http.StatusBadRequest, "incorrect at\n"},
+		{"/cafe?city=kazan&at=12:00&count=1&format=json", http.StatusOK, `[{"name":"Чак-чак","hours":"08:00-22:00"}]`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestCafeTags(t *testing.T) {
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{
+		"kazan": {
+			{Name: "Чак-чак", Tags: []string{"Dessert", "coffee"}},
+			{Name: "Эчпочмак", Tags: []string{"breakfast"}},
+			{Name: "Кофейня у Кремля", Tags: []string{"coffee", "breakfast"}},
+			{Name: "Бахетле"},
+		},
+		"perm": {},
+	})
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=kazan&tag=coffee", http.StatusOK, "Чак-чак,Кофейня у Кремля"},
+		{"/cafe?city=kazan&tag=DESSERT", http.StatusOK, "Чак-чак"},
+		{"/cafe?city=kazan&tag=coffee&tag=breakfast", http.StatusOK, "Кофейня у Кремля"},
+		{"/cafe?city=kazan&tag=vegan", http.StatusOK, ""},
+		{"/cafe?city=kazan&tag=", http.StatusOK, "Чак-чак,Эчпочмак,Кофейня у Кремля,Бахетле"},
+		{"/cafe?city=kazan&tag=breakfast&format=json", http.StatusOK,
+			`[{"name":"Эчпочмак","tags":["breakfast"]},{"name":"Кофейня у Кремля","tags":["coffee","breakfast"]}]`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+
+	tags := NewTagsHandler(store)
+	requests = []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/tags?city=kazan", http.StatusOK, "breakfast:2,coffee:2,dessert:1"},
+		{"/tags?city=kazan&format=json", http.StatusOK, `{"breakfast":2,"coffee":2,"dessert":1}`},
+		{"/tags?city=perm&format=json", http.StatusOK, `{}`},
+		{"/tags?city=perm", http.StatusOK, ""},
+		{"/tags?city=omsk", http.StatusBadRequest, "unknown city\n"},
+		{"/tags?city=kazan&withCounts=true", http.StatusOK, "breakfast:2,coffee:2,dessert:1"},
+		{"/tags?city=kazan&withCounts=false", http.StatusOK, "breakfast,coffee,dessert"},
+		{"/tags?city=kazan&withCounts=false&format=json", http.StatusOK, `["breakfast","coffee","dessert"]`},
+		{"/tags?city=perm&withCounts=false&format=json", http.StatusOK, `[]`},
+		{"/tags?city=omsk&withCounts=false", http.StatusBadRequest, "unknown city\n"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		tags.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestCafeFeatured(t *testing.T) {
+	rating := func(v float64) *float64 { return &v }
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{
+		"kazan": {
+			{Name: "Чак-чак", Rating: rating(4)},
+			{Name: "Эчпочмак", Featured: true},
+			{Name: "Кофейня у Кремля", Rating: rating(5)},
+			{Name: "Бахетле", Featured: true, Rating: rating(3)},
+		},
+	})
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=kazan", "Эчпочмак,Бахетле,Чак-чак,Кофейня у Кремля"},
+		{"/cafe?city=kazan&count=1", "Эчпочмак"},
+		{"/cafe?city=kazan&count=3", "Эчпочмак,Бахетле,Чак-чак"},
+		{"/cafe?city=kazan&offset=1&count=2", "Бахетле,Чак-чак"},
+		{"/cafe?city=kazan&search=к", "Эчпочмак,Чак-чак,Кофейня у Кремля"},
+		{"/cafe?city=kazan&featuredOnly=true", "Эчпочмак,Бахетле"},
+		{"/cafe?city=kazan&featuredOnly=true&count=1", "Эчпочмак"},
+		{"/cafe?city=kazan&featuredOnly=true&search=чак", ""},
+		// явная сортировка важнее продвижения
+		{"/cafe?city=kazan&sort=name&count=2", "Бахетле,Кофейня у Кремля"},
+		{"/cafe?city=kazan&sort=rating&count=2", "Кофейня у Кремля,Чак-чак"},
+		{"/cafe?city=kazan&featuredOnly=true&sort=name", "Бахетле,Эчпочмак"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=kazan&count=1&format=json", nil))
+	assert.Equal(t, `[{"name":"Эчпочмак","featured":true}]`, response.Body.String())
+}
+
+func TestCafeSuggestCity(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=mosow", "unknown city (did you mean moscow?)"},
+		{"/cafe?city=Moskow", "unknown city (did you mean moscow?)"},
+		{"/cafe?city=tul", "unknown city (did you mean tula?)"},
+		{"/cafe?city=msk", "unknown city"},
+		{"/cafe?city=omsk", "unknown city"},
+		{"/cafe", "unknown city"},
+		{"/cafe?city=tula,mosow", "unknown city: mosow (did you mean moscow?)"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeHead(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []string{
+		"/cafe?city=moscow&search=кофе",
+		"/cafe?city=tula&format=json",
+		"/cafe?city=omsk",
+		"/cafe?city=moscow&count=na",
+	}
+	for _, request := range requests {
+		get := httptest.NewRecorder()
+		handler.ServeHTTP(get, httptest.NewRequest("GET", request, nil))
+
+		head := httptest.NewRecorder()
+		handler.ServeHTTP(head, httptest.NewRequest("HEAD", request, nil))
+
+		assert.Equal(t, get.Code, head.Code, request)
+		assert.Empty(t, head.Body.String(), request)
+		assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"), request)
+		assert.Equal(t, get.Header().Get("X-Total-Count"), head.Header().Get("X-Total-Count"), request)
+		assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"), request)
+	}
+}
+
+func TestCafeJSONP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.JSONP = true
+	handler := newCafeHandler(defaultStore, cfg)
+
+	requests := []struct {
+		request     string
+		status      int
+		contentType string
+		want        string
+	}{
+		{"/cafe?city=tula&count=1&format=json&callback=myFn", http.StatusOK,
+			"application/javascript; charset=utf-8", `myFn([{"name":"Пир и мир"}]);`},
+		{"/cafe?city=tula&count=1&format=json&callback=widget.render_1", http.StatusOK,
+			"application/javascript; charset=utf-8", `widget.render_1([{"name":"Пир и мир"}]);`},
+		{"/cafe?city=tula&count=1&format=json&callback=alert(1)", http.StatusBadRequest,
+			"application/json; charset=utf-8", `{"error":"invalid callback"}`},
+		{"/cafe?city=tula&count=1&format=json&callback=" + url.QueryEscape("</script>"), http.StatusBadRequest,
+			"application/json; charset=utf-8", `{"error":"invalid callback"}`},
+		// без JSON callback ни на что не влияет
+		{"/cafe?city=tula&count=1&callback=myFn", http.StatusOK, "text/plain; charset=utf-8", "Пир и мир"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.contentType, response.Header().Get("Content-Type"), v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+
+	// по умолчанию JSONP выключен
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/cafe?city=tula&count=1&format=json&callback=myFn", nil)
+	http.HandlerFunc(mainHandle).ServeHTTP(response, req)
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, `[{"name":"Пир и мир"}]`, response.Body.String())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics — метрики Prometheus для обработчиков сервиса.
+type metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// newMetrics регистрирует в reg метрики запросов и число кафе
+// по городам из store.
+func newMetrics(reg prometheus.Registerer, store CafeStore) *metrics {
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cafe_http_requests_total",
+			Help: "Number of HTTP requests by route and status code.",
+		}, []string{"path", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cafe_http_request_duration_seconds",
+			Help:    "HTTP request latency by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path"}),
+	}
+	reg.MustRegister(m.requests, m.duration, newCafesCollector(store))
+	return m
+}
+
+// handler записывает в метрики каждый запрос к next. Путь берётся
+// из шаблона маршрута, чтобы произвольные URL не плодили метки.
+func (m *metrics) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// ServeMux записывает найденный шаблон в req.Pattern;
+		// шаблон / ловит только неизвестные адреса
+		path := req.Pattern
+		if path == "" || path == "/" {
+			path = "unmatched"
+		}
+		m.requests.WithLabelValues(path, strconv.Itoa(status)).Inc()
+		m.duration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+	})
+}
+
+// cafesCollector отдаёт число кафе по городам, читая store при каждом
+// сборе метрик, поэтому значения сразу отражают перезагрузку данных.
+type cafesCollector struct {
+	store CafeStore
+	desc  *prometheus.Desc
+}
+
+func newCafesCollector(store CafeStore) *cafesCollector {
+	return &cafesCollector{
+		store: store,
+		desc: prometheus.NewDesc("cafe_cafes",
+			"Number of cafes loaded per city.", []string{"city"}, nil),
+	}
+}
+
+func (c *cafesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *cafesCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, city := range c.store.Cities() {
+		cafe, _ := c.store.Cafes(city)
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(len(cafe)), city)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	store := NewMemoryStore(cafeList)
+	m := newMetrics(reg, store)
+	handler := m.handler(newMux(store))
+
+	for _, request := range []string{"/cafe?city=moscow", "/cafe?city=tula", "/cafe?city=omsk", "/unknown"} {
+		req := httptest.NewRequest("GET", request, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("/cafe", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("/cafe", "400")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("unmatched", "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.duration))
+
+	expected := `
+# HELP cafe_cafes Number of cafes loaded per city.
+# TYPE cafe_cafes gauge
+cafe_cafes{city="moscow"} 5
+cafe_cafes{city="tula"} 3
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "cafe_cafes"))
+
+	// после перезагрузки данных метрика отражает новый набор
+	store.Replace(map[string][]string{"kazan": {"Чак-чак"}})
+	expected = `
+# HELP cafe_cafes Number of cafes loaded per city.
+# TYPE cafe_cafes gauge
+cafe_cafes{city="kazan"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "cafe_cafes"))
+}
+
+func TestMetricsWithoutMux(t *testing.T) {
+	m := newMetrics(prometheus.NewRegistry(), defaultStore)
+	handler := m.handler(http.NotFoundHandler())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("unmatched", "404")))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// responseRecorder запоминает код и размер ответа для журнала.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.size += n
+	return n, err
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logHandler пишет в logger на уровне info по записи на каждый запрос
+// к next: метод, URL, код ответа, размер тела и время обработки.
+// Текстом или JSON — решает обработчик logger.
+func logHandler(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+
+		// обработчик, ничего не записавший, отвечает 200
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logger.LogAttrs(req.Context(), slog.LevelInfo, "request",
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.String()),
+			slog.Int("status", status),
+			slog.Int("size", rec.size),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// recoverHandler перехватывает панику в next, пишет в logger на уровне
+// error стек вызовов и отвечает клиенту 500 internal error.
+func recoverHandler(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// так net/http намеренно прерывает ответ, это не ошибка
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			logger.ErrorContext(req.Context(), fmt.Sprintf("panic serving %s %s: %v", req.Method, req.URL, err),
+				"stack", string(debug.Stack()))
+			writeError(w, req, http.StatusInternalServerError, "internal error")
+		}()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// corsHandler разрешает браузерам обращаться к next с источника origin
+// и отвечает 204 на предварительные запросы OPTIONS. При пустом origin
+// заголовки CORS не добавляются.
+func corsHandler(next http.Handler, origin string) http.Handler {
+	if origin == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		if origin != "*" {
+			h.Add("Vary", "Origin")
+		}
+		h.Set("Access-Control-Expose-Headers", "X-Total-Count, X-Cafe-City, X-Page, X-Per-Page, X-Total-Pages, Link, X-Skipped, X-Match-Strategy")
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			h.Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-API-Key")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// bodyLimitHandler ограничивает тело запроса к next limit байтами:
+// чтение сверх него возвращает *http.MaxBytesError, на которую
+// обработчик отвечает 413. При limit <= 0 размер не ограничивается.
+func bodyLimitHandler(next http.Handler, limit int64) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Body = http.MaxBytesReader(w, req.Body, limit)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// checkedParams перечисляет параметры, в которых controlCharsHandler
+// не допускает управляющих символов.
+var checkedParams = []string{"city", "search"}
+
+// controlCharsHandler отвечает 400 invalid characters, если в параметрах
+// checkedParams запроса есть управляющие символы Unicode (категория Cc),
+// например перевод строки: такие значения могли бы испортить журнал
+// или ответ. Остальные символы, включая кириллицу, пропускаются к next.
+func controlCharsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		for _, name := range checkedParams {
+			for _, value := range query[name] {
+				if strings.ContainsFunc(value, unicode.IsControl) {
+					writeError(w, req, http.StatusBadRequest, "invalid characters")
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// timeoutHandler ограничивает время обработки запроса к next: по истечении
+// timeout контекст запроса отменяется, а клиент получает 503 timeout
+// в том же виде, что и остальные ошибки API. Ответ next копится целиком
+// и отправляется, только если next успел. При timeout <= 0 время
+// не ограничивается.
+func timeoutHandler(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		// next видит уже выставленные снаружи заголовки, например CORS
+		rec := &headerRecorder{header: w.Header().Clone()}
+		inner := req.WithContext(ctx)
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(rec, inner)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			// паника передаётся дальше, к recoverHandler
+			panic(p)
+		case <-done:
+			maps.Copy(w.Header(), rec.header)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		case <-ctx.Done():
+			// если клиент ушёл сам, отвечать некому
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				writeError(w, req, http.StatusServiceUnavailable, "timeout")
+			}
+		}
+	})
+}
+
+// trailingSlashHandler перенаправляет запросы с косой чертой в конце пути,
+// например /cafe/, на тот же путь без неё с кодом 308, сохраняя строку
+// запроса. Код 308 не меняет метод и тело, поэтому POST тоже переносится.
+func trailingSlashHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p := req.URL.Path; len(p) > 1 && strings.HasSuffix(p, "/") {
+			// Clean заодно склеивает повторные косые черты, иначе
+			// //example.com/ превратился бы в ссылку на чужой сайт
+			target := path.Clean(p)
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+			http.Redirect(w, req, target, http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
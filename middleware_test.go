@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandlerText(t *testing.T) {
+	var buf bytes.Buffer
+	handler := logHandler(newMux(defaultStore), newLogger(&buf, DefaultConfig()))
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&count=2", fmt.Sprintf(`level=INFO msg=request method=GET url="/cafe?city=moscow&count=2" status=200 size=%d `, len("Мир кофе,Сладкоежка"))},
+		{"/cafe?city=omsk", fmt.Sprintf(`level=INFO msg=request method=GET url="/cafe?city=omsk" status=400 size=%d `, len("unknown city\n"))},
+	}
+	for _, v := range requests {
+		buf.Reset()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Contains(t, buf.String(), v.want)
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	}
+}
+
+func TestLogHandlerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	handler := logHandler(newMux(defaultStore), newLogger(&buf, Config{LogFormat: "json"}))
+
+	req := httptest.NewRequest("DELETE", "/cafe?city=omsk&name=Дубок", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Level    string
+		Msg      string
+		Method   string
+		URL      string
+		Status   int
+		Size     int
+		Duration time.Duration
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry.Level)
+	assert.Equal(t, "request", entry.Msg)
+	assert.Equal(t, "DELETE", entry.Method)
+	assert.Equal(t, req.URL.String(), entry.URL)
+	assert.Equal(t, http.StatusBadRequest, entry.Status)
+	assert.Equal(t, len("unknown city\n"), entry.Size)
+	assert.Positive(t, entry.Duration)
+}
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	// отладочные записи /cafe идут через журнал по умолчанию
+	prevLogger, prevWriter, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prevLogger)
+		log.SetOutput(prevWriter)
+		log.SetFlags(prevFlags)
+	})
+
+	levels := []struct {
+		level   slog.Level
+		request bool
+		filters bool
+	}{
+		{slog.LevelDebug, true, true},
+		{slog.LevelInfo, true, false},
+		{slog.LevelWarn, false, false},
+	}
+	for _, v := range levels {
+		buf.Reset()
+		logger := newLogger(&buf, Config{LogLevel: v.level})
+		slog.SetDefault(logger)
+		handler := logHandler(newMux(defaultStore), logger)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/cafe?city=moscow&search=кофе&count=2", nil))
+
+		assert.Equal(t, v.request, strings.Contains(buf.String(), "msg=request"), v.level)
+		assert.Equal(t, v.filters, strings.Contains(buf.String(), `msg="cafe filters" cities=[moscow] count=2 offset=0 search=`), v.level)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	var buf bytes.Buffer
+	mux := newMux(defaultStore)
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, req *http.Request) {
+		var cafes map[string][]string
+		cafes["moscow"] = nil
+	})
+	server := httptest.NewServer(recoverHandler(mux, newLogger(&buf, DefaultConfig())))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "internal error", strings.TrimSpace(string(body)))
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), "panic serving GET /panic")
+	assert.Contains(t, buf.String(), "goroutine")
+
+	// после паники сервер продолжает обслуживать запросы
+	resp, err = http.Get(server.URL + "/cafe?city=tula&count=1")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Пир и мир", string(body))
+}
+
+func TestCorsHandler(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		handler := corsHandler(newMux(defaultStore), "")
+
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=tula", nil)
+		req.Header.Set("Origin", "https://example.com")
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("simple request", func(t *testing.T) {
+		handler := corsHandler(newMux(defaultStore), "https://example.com")
+
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=tula", nil)
+		req.Header.Set("Origin", "https://example.com")
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "https://example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Total-Count, X-Cafe-City, X-Page, X-Per-Page, X-Total-Pages, Link, X-Skipped, X-Match-Strategy", response.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", response.Header().Get("Vary"))
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		handler := corsHandler(newMux(defaultStore), "*")
+
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "/cafe?city=tula", nil)
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST, DELETE", response.Header().Get("Access-Control-Allow-Methods"))
+		assert.Zero(t, response.Body.Len())
+	})
+}
+
+// slowStore — хранилище, которое отвечает на Details с задержкой delay.
+type slowStore struct {
+	mockStore
+	delay time.Duration
+}
+
+func (s slowStore) Details(city string) ([]Cafe, bool) {
+	time.Sleep(s.delay)
+	return s.mockStore.Details(city)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	store := slowStore{mockStore: mockStore{"kazan": {"Чак-чак"}}, delay: 200 * time.Millisecond}
+
+	cfg := DefaultConfig()
+	cfg.RequestTimeout = 20 * time.Millisecond
+	requests := []struct {
+		accept   string
+		language string
+		ctype    string
+		body     string
+	}{
+		{"", "", "text/plain; charset=utf-8", "timeout"},
+		{"", "ru", "text/plain; charset=utf-8", "превышено время ожидания"},
+		{"application/json", "", "application/json; charset=utf-8", `{"error":"timeout"}`},
+		{"application/json", "ru", "application/json; charset=utf-8", `{"error":"превышено время ожидания"}`},
+	}
+	for _, v := range requests {
+		req := httptest.NewRequest("GET", "/v1/cafe?city=kazan", nil)
+		req.Header.Set("Accept", v.accept)
+		req.Header.Set("Accept-Language", v.language)
+		response := httptest.NewRecorder()
+		NewServer(store, cfg, slog.New(slog.DiscardHandler), nil).mux().ServeHTTP(response, req)
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code, v)
+		assert.Equal(t, v.ctype, response.Header().Get("Content-Type"), v)
+		assert.Equal(t, v.body, strings.TrimSpace(response.Body.String()), v)
+	}
+
+	// с запасом по времени запрос успевает
+	cfg.RequestTimeout = 5 * time.Second
+	response := httptest.NewRecorder()
+	NewServer(store, cfg, slog.New(slog.DiscardHandler), nil).mux().ServeHTTP(response, httptest.NewRequest("GET", "/v1/cafe?city=kazan", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Чак-чак", response.Body.String())
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	handler := NewServer(NewMemoryStore(cafeList), DefaultConfig(), slog.New(slog.DiscardHandler), nil).Routes()
+
+	requests := []struct {
+		method   string
+		request  string
+		location string
+	}{
+		{"GET", "/v1/cafe/?city=moscow&search=%D0%BA%D0%BE%D1%84%D0%B5&count=2", "/v1/cafe?city=moscow&search=%D0%BA%D0%BE%D1%84%D0%B5&count=2"},
+		{"GET", "/cafe/", "/cafe"},
+		{"GET", "/v1/cities/", "/v1/cities"},
+		{"POST", "/v1/cafe/batch/", "/v1/cafe/batch"},
+		{"GET", "//example.com/", "/example.com"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(v.method, v.request, nil))
+
+		assert.Equal(t, http.StatusPermanentRedirect, response.Code, v.request)
+		assert.Equal(t, v.location, response.Header().Get("Location"), v.request)
+	}
+
+	// по адресу перенаправления отвечает обычный обработчик
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/v1/cafe?city=moscow&search=%D0%BA%D0%BE%D1%84%D0%B5&count=2", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Мир кофе,Кофе и завтраки", response.Body.String())
+}
+
+func TestControlChars(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewServer(NewMemoryStore(cafeList), DefaultConfig(), newLogger(&buf, DefaultConfig()), nil).Routes()
+
+	requests := []struct {
+		method  string
+		request string
+		body    string
+		status  int
+		want    string
+	}{
+		{"GET", "/v1/cafe?city=moscow&search=%D0%BA%D0%BE%D1%84%D0%B5%0Aadmin", "", http.StatusBadRequest, "invalid characters"},
+		{"GET", "/v1/cafe?city=moscow%0D%0A&search=%D0%BA%D0%BE%D1%84%D0%B5", "", http.StatusBadRequest, "invalid characters"},
+		{"GET", "/v1/cafe?city=moscow&search=%09", "", http.StatusBadRequest, "invalid characters"},
+		// U+0085 — тоже управляющий символ, хотя и не из ASCII
+		{"GET", "/v1/cafe/count?city=moscow&search=%C2%85", "", http.StatusBadRequest, "invalid characters"},
+		{"GET", "/v1/cafe/random?search=%00", "", http.StatusBadRequest, "invalid characters"},
+		{"GET", "/v1/cafe/lookup?city=tula%0A&name=%D0%9F%D0%B8%D1%80", "", http.StatusBadRequest, "invalid characters"},
+		{"POST", "/v1/cafe/batch", `[{"city":"moscow","search":"кофе\nadmin"},{"city":"tula","count":1}]`, http.StatusOK, `[{"city":"moscow","error":"invalid characters"},{"city":"tula","cafes":[{"name":"Пир и мир"}]}]`},
+		// обычный текст, в том числе кириллица и пробелы, проходит
+		{"GET", "/v1/cafe?city=moscow&search=%D0%BC%D0%B8%D1%80%20%D0%BA%D0%BE%D1%84%D0%B5", "", http.StatusOK, "Мир кофе"},
+		{"GET", "/v1/cafe/count?city=moscow&search=%D0%BA%D0%BE%D1%84%D0%B5", "", http.StatusOK, "2"},
+	}
+	for _, v := range requests {
+		buf.Reset()
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(v.method, v.request, strings.NewReader(v.body)))
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+		// запрос занимает в журнале ровно одну строку
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"), v.request)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec — описание API в формате OpenAPI 3.0.
+// При изменении параметров /cafe его нужно обновлять вместе с cafeParams.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandle отдаёт описание API.
+func openAPIHandle(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI(t *testing.T) {
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	newMux(defaultStore).ServeHTTP(response, req)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	// описание должно совпадать с параметрами, которые понимает обработчик
+	var names []string
+	for _, p := range spec.Paths["/v1/cafe"]["get"].Parameters {
+		names = append(names, p.Name)
+	}
+	slices.Sort(names)
+	assert.Equal(t, cafeParams, names)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock — управляемые часы для rateLimiter.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	limiter := newRateLimiter(2, 3)
+	limiter.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.allow("10.0.0.1")
+		assert.True(t, ok, "request %d", i)
+	}
+	ok, wait := limiter.allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// у другого клиента своя корзина
+	ok, _ = limiter.allow("10.0.0.2")
+	assert.True(t, ok)
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	ok, _ = limiter.allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = limiter.allow("10.0.0.1")
+	assert.False(t, ok)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	limiter := newRateLimiter(1, 2)
+	limiter.now = clock.now
+
+	limiter.allow("10.0.0.1")
+	limiter.allow("10.0.0.1")
+	clock.t = clock.t.Add(time.Second)
+	limiter.allow("10.0.0.2")
+	limiter.allow("10.0.0.2")
+
+	limiter.sweep()
+	assert.Len(t, limiter.buckets, 2, "buckets are not refilled yet")
+
+	clock.t = clock.t.Add(time.Second)
+	limiter.sweep()
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "10.0.0.2")
+
+	clock.t = clock.t.Add(time.Second)
+	limiter.sweep()
+	assert.Empty(t, limiter.buckets)
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	handler := rateLimitHandler(newMux(defaultStore), newRateLimiter(0.5, 1))
+
+	requests := []struct {
+		remoteAddr string
+		status     int
+		retryAfter string
+	}{
+		{"10.0.0.1:1234", http.StatusOK, ""},
+		{"10.0.0.1:5678", http.StatusTooManyRequests, "2"},
+		{"10.0.0.2:1234", http.StatusOK, ""},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/cafe?city=tula", nil)
+		req.RemoteAddr = v.remoteAddr
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.retryAfter, response.Header().Get("Retry-After"))
+		if v.status == http.StatusTooManyRequests {
+			assert.Equal(t, "too many requests", strings.TrimSpace(response.Body.String()))
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Форматы ответа со списком кафе.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXML  = "xml"
+	// кафе с координатами как FeatureCollection по RFC 7946
+	formatGeoJSON = "geojson"
+)
+
+// accepts сообщает, перечислен ли mediaType в заголовке Accept.
+func accepts(req *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		t, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(t), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsJSON сообщает, просит ли клиент ответ в формате JSON.
+func acceptsJSON(req *http.Request) bool {
+	return req.FormValue("format") == formatJSON || accepts(req, "application/json")
+}
+
+// responseFormat выбирает формат ответа. Параметр format важнее
+// заголовка Accept; по умолчанию ответ — обычный текст.
+func responseFormat(req *http.Request) (string, error) {
+	switch format := req.FormValue("format"); format {
+	case "":
+	case formatText, formatJSON, formatCSV, formatXML, formatGeoJSON:
+		return format, nil
+	default:
+		return "", errors.New("incorrect format")
+	}
+	switch {
+	case accepts(req, "application/json"):
+		return formatJSON, nil
+	case accepts(req, "text/csv"):
+		return formatCSV, nil
+	case accepts(req, "application/xml"):
+		return formatXML, nil
+	case accepts(req, "application/geo+json"):
+		return formatGeoJSON, nil
+	}
+	return formatText, nil
+}
+
+// writeError отвечает клиенту ошибкой msg с кодом status: обычным
+// текстом или, если клиент просит JSON, в виде {"error":"msg"}.
+// Сообщение переводится на язык из заголовка Accept-Language.
+func writeError(w http.ResponseWriter, req *http.Request, status int, msg string) {
+	msg = localize(requestLanguage(req), msg)
+	if !acceptsJSON(req) {
+		http.Error(w, msg, status)
+		return
+	}
+	data, _ := marshalJSON(req, map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// writeBodyError отвечает на ошибку чтения тела запроса err: 413, если
+// тело длиннее допустимого, иначе 400 с сообщением msg.
+func writeBodyError(w http.ResponseWriter, req *http.Request, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, req, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	writeError(w, req, http.StatusBadRequest, msg)
+}
+
+// writeText записывает s в ответ как обычный текст в UTF-8.
+func writeText(w http.ResponseWriter, s string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, s)
+}
+
+// callbackPattern — допустимое имя функции JSONP: идентификатор
+// JavaScript, возможно через точку, как widget.render.
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// marshalJSON кодирует v в JSON: с отступом в два пробела, если
+// в запросе req есть pretty=true, иначе компактно.
+func marshalJSON(req *http.Request, v any) ([]byte, error) {
+	if req.FormValue("pretty") == "true" {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// writeJSONP отвечает v в JSON, обёрнутым в вызов функции callback.
+// Имя callback должно быть заранее проверено по callbackPattern.
+func writeJSONP(w http.ResponseWriter, req *http.Request, callback string, v any) {
+	data, err := marshalJSON(req, v)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprintf(w, "%s(%s);", callback, data)
+}
+
+// cafeFields — ключи JSON-объекта кафе, взятые из тегов полей Cafe.
+var cafeFields = func() []string {
+	t := reflect.TypeFor[Cafe]()
+	fields := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+	return fields
+}()
+
+// parseFields разбирает список ключей кафе через запятую для fields.
+// Пустые элементы пропускаются; name включается всегда. Для пустого
+// списка возвращается nil: кафе отдаются целиком.
+func parseFields(s string) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if !slices.Contains(cafeFields, f) {
+			return nil, errors.New("unknown field")
+		}
+		fields = append(fields, f)
+	}
+	if fields != nil && !slices.Contains(fields, "name") {
+		fields = append(fields, "name")
+	}
+	return fields, nil
+}
+
+// projectCafe возвращает JSON-объект кафе c, в котором оставлены только
+// ключи fields. Пустые значения, как и в полном объекте, опускаются.
+func projectCafe(c Cafe, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	maps.DeleteFunc(all, func(key string, _ json.RawMessage) bool {
+		return !slices.Contains(fields, key)
+	})
+	return all, nil
+}
+
+// writeJSON записывает v в ответ в формате JSON, как marshalJSON.
+func writeJSON(w http.ResponseWriter, req *http.Request, v any) {
+	data, err := marshalJSON(req, v)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// writeCSV записывает кафе в ответ как CSV-файл по RFC 4180:
+// строка заголовка name и по одному названию в строке.
+func writeCSV(w http.ResponseWriter, cafe []string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="cafes.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	cw.Write([]string{"name"})
+	for _, name := range cafe {
+		cw.Write([]string{name})
+	}
+	cw.Flush()
+}
+
+// xmlCafes — список кафе в XML: <cafes><cafe>Название</cafe>...</cafes>.
+type xmlCafes struct {
+	XMLName xml.Name `xml:"cafes"`
+	Cafes   []string `xml:"cafe"`
+}
+
+// writeXML записывает названия кафе в ответ в формате XML.
+// Символы вроде < и & в названиях экранируются.
+func writeXML(w http.ResponseWriter, cafe []string) {
+	data, err := xml.Marshal(xmlCafes{Cafes: cafe})
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(data)
+}
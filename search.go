@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultMaxDistance — допустимое по умолчанию число опечаток при fuzzy=true.
+const defaultMaxDistance = 1
+
+// searchQuery описывает условия поиска по названию кафе.
+type searchQuery struct {
+	terms    []string // искомые строки, обработанные normalizeName
+	exclude  []string // исключаемые строки, обработанные normalizeName
+	matchAll bool     // название должно подходить под все строки, а не под одну
+	prefix   bool     // название должно начинаться с искомой строки
+	// wholeWord требует, чтобы искомая строка не была частью
+	// более длинного слова названия
+	wholeWord bool
+	// wordPrefix разрешает слову названия и искомой строке совпадать
+	// началом: по «кофе» находится «Кофейня», а по «кофейня» — «Мир кофе»
+	wordPrefix  bool
+	fold        bool // не различать ё и е и буквы с диакритикой
+	fuzzy       bool // допускать опечатки
+	maxDistance int  // наибольшее расстояние Левенштейна при fuzzy
+	// regex, если задан, заменяет terms: название должно подходить
+	// под регулярное выражение
+	regex *regexp.Regexp
+}
+
+// maxRegexLen — наибольшая длина регулярного выражения в байтах.
+const maxRegexLen = 100
+
+// compileRegex разбирает search как регулярное выражение RE2 без учёта
+// регистра. Текст ошибки предназначен для ответа клиенту.
+func compileRegex(search string) (*regexp.Regexp, error) {
+	if len(search) > maxRegexLen {
+		return nil, errors.New("regex too long")
+	}
+	re, err := regexp.Compile("(?i)" + search)
+	if err != nil {
+		return nil, errors.New("invalid regex")
+	}
+	return re, nil
+}
+
+// key возвращает представление запроса для ключа кеша:
+// у регулярного выражения учитывается только исходный текст.
+func (q searchQuery) key() string {
+	regex := ""
+	if q.regex != nil {
+		regex = q.regex.String()
+		q.regex = nil
+	}
+	return fmt.Sprintf("%#v %q", q, regex)
+}
+
+// parseSearch разбирает параметры поиска search, exclude, match, mode, fold,
+// fuzzy, maxDistance, translit и wholeWord. В search можно передать несколько строк через запятую;
+// при match=any (по умолчанию) кафе должно подходить хотя бы под одну
+// из них, при match=all — под все. При mode=contains (по умолчанию)
+// строка ищется в любом месте названия, при mode=prefix — только в начале.
+// При wholeWord=true до и после строки в названии не должно быть букв:
+// «кофе» находит «Мир кофе», но не «Антикофейню».
+// При fold=true ё не отличается от е, а é — от e. Каждый параметр exclude
+// убирает кафе, в названии которых есть его строка, даже если они подошли
+// под search. При translit=true латинские буквы search переводятся
+// в русские функцией transliterate. Текст ошибки предназначен для ответа клиенту.
+func parseSearch(req *http.Request) (searchQuery, error) {
+	query := searchQuery{
+		fold:        req.FormValue("fold") == "true",
+		fuzzy:       req.FormValue("fuzzy") == "true",
+		wholeWord:   req.FormValue("wholeWord") == "true",
+		maxDistance: defaultMaxDistance,
+	}
+	translit := req.FormValue("translit") == "true"
+	// пустые строки и строки из одних пробелов пропускаются
+	for _, term := range strings.Split(req.FormValue("search"), ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			if translit {
+				term = transliterate(term)
+			}
+			query.terms = append(query.terms, normalizeName(term, query.fold))
+		}
+	}
+	for _, term := range req.URL.Query()["exclude"] {
+		if term = strings.TrimSpace(term); term != "" {
+			query.exclude = append(query.exclude, normalizeName(term, query.fold))
+		}
+	}
+	switch req.FormValue("match") {
+	case "", "any":
+	case "all":
+		query.matchAll = true
+	default:
+		return query, errors.New("incorrect match")
+	}
+	switch req.FormValue("mode") {
+	case "", "contains":
+	case "prefix":
+		query.prefix = true
+	default:
+		return query, errors.New("incorrect mode")
+	}
+	if s := req.FormValue("maxDistance"); s != "" {
+		d, err := strconv.Atoi(s)
+		if err != nil || d < 0 {
+			return query, errors.New("incorrect maxDistance")
+		}
+		query.maxDistance = d
+	}
+	return query, nil
+}
+
+// match сообщает, подходит ли название кафе под поиск.
+func (q searchQuery) match(name string) bool {
+	return q.matchNormalized(normalizeName(name, q.fold))
+}
+
+// empty сообщает, что запрос не отбрасывает ни одного кафе.
+func (q searchQuery) empty() bool {
+	return len(q.terms) == 0 && len(q.exclude) == 0 && q.regex == nil
+}
+
+// matchNormalized — то же, что match, для названия,
+// уже обработанного normalizeName с тем же fold.
+func (q searchQuery) matchNormalized(name string) bool {
+	for _, term := range q.exclude {
+		if strings.Contains(name, term) {
+			return false
+		}
+	}
+	if q.regex != nil {
+		return q.regex.MatchString(name)
+	}
+	if len(q.terms) == 0 {
+		return true
+	}
+	for _, term := range q.terms {
+		ok := q.matchTerm(name, term)
+		if ok && !q.matchAll {
+			return true
+		}
+		if !ok && q.matchAll {
+			return false
+		}
+	}
+	return q.matchAll
+}
+
+// matchTerm сообщает, подходит ли обработанное название под одну
+// искомую строку. Без fuzzy название должно содержать её целиком
+// или, при prefix, начинаться с неё, а при wholeWord — отдельным словом.
+// При wordPrefix подходят и названия, слово которых начинается с искомой
+// строки или само начинает её. С fuzzy подходят также названия, целиком
+// или одним из слов отличающиеся от искомой строки не более чем
+// на maxDistance правок.
+func (q searchQuery) matchTerm(name, term string) bool {
+	if q.contains(name, term) {
+		return true
+	}
+	if q.wordPrefix {
+		for _, word := range strings.FieldsFunc(name, isSeparator) {
+			if strings.HasPrefix(word, term) || utf8.RuneCountInString(word) >= minStemLen && strings.HasPrefix(term, word) {
+				return true
+			}
+		}
+	}
+	if !q.fuzzy {
+		return false
+	}
+	if levenshtein(name, term) <= q.maxDistance {
+		return true
+	}
+	for _, word := range strings.FieldsFunc(name, isSeparator) {
+		if levenshtein(word, term) <= q.maxDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// contains ищет term в name: при prefix только в начале,
+// при wholeWord только между границами слов.
+func (q searchQuery) contains(name, term string) bool {
+	if !q.wholeWord {
+		if q.prefix {
+			return strings.HasPrefix(name, term)
+		}
+		return strings.Contains(name, term)
+	}
+	if q.prefix {
+		return strings.HasPrefix(name, term) && wordBounded(name, 0, len(term))
+	}
+	for i := 0; i < len(name); {
+		j := strings.Index(name[i:], term)
+		if j < 0 {
+			return false
+		}
+		j += i
+		if wordBounded(name, j, j+len(term)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(name[j:])
+		i = j + size
+	}
+	return false
+}
+
+// wordBounded сообщает, что перед байтом start и после байта end строки s
+// нет букв: подстрока s[start:end] не продолжает соседнее слово.
+// Диакритические знаки считаются частью буквы, к которой относятся.
+func wordBounded(s string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:start])
+	after, _ := utf8.DecodeRuneInString(s[end:])
+	return (start == 0 || !isWordRune(before)) && (end == len(s) || !isWordRune(after))
+}
+
+// isWordRune сообщает, может ли r быть частью слова при wholeWord.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
+
+// minStemLen — наименьшая длина в рунах слова названия, которое
+// при wordPrefix может быть началом искомой строки: короче подходили бы
+// предлоги и союзы.
+const minStemLen = 3
+
+// searchStrategy — вариант поиска и его название для X-Match-Strategy.
+type searchStrategy struct {
+	name  string
+	query searchQuery
+}
+
+// broaden возвращает всё более широкие варианты q для minResults, каждый
+// из которых находит всё то же, что и предыдущий: prefix — ещё и названия,
+// слово которых совпадает с искомой строкой началом, как при wordPrefix,
+// fuzzy — ещё и названия с опечатками, all — все кафе без учёта search.
+// Исключения exclude сохраняются. Регулярное выражение расширяется сразу
+// до all, а запрос без search расширять некуда.
+func (q searchQuery) broaden() []searchStrategy {
+	if len(q.terms) == 0 && q.regex == nil {
+		return nil
+	}
+	all := q
+	all.terms, all.regex = nil, nil
+	if q.regex != nil {
+		return []searchStrategy{{"all", all}}
+	}
+	prefix := q
+	prefix.wordPrefix = true
+	fuzzy := prefix
+	fuzzy.fuzzy = true
+	return []searchStrategy{{"prefix", prefix}, {"fuzzy", fuzzy}, {"all", all}}
+}
+
+// normalizeName готовит название кафе или искомую строку к сравнению:
+// приводит к форме NFC и нижнему регистру. При fold у латинских букв
+// убирается диакритика, а ё заменяется на е; диакритика кириллицы
+// сохраняется, чтобы й не совпадала с и.
+func normalizeName(s string, fold bool) string {
+	if !fold {
+		return strings.ToLower(norm.NFC.String(s))
+	}
+	var b strings.Builder
+	var base rune
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			base = r
+		} else if !unicode.Is(unicode.Cyrillic, base) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s = strings.ToLower(norm.NFC.String(b.String()))
+	return strings.ReplaceAll(s, "ё", "е")
+}
+
+// isSeparator сообщает, разделяет ли r слова в названии кафе.
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// searchCafes возвращает кафе, подходящие под запрос query.
+// Пустой запрос возвращает все кафе.
+func searchCafes(cafe []string, query searchQuery) []string {
+	if query.empty() {
+		return cafe
+	}
+	var found []string
+
+	for _, v := range cafe {
+		if query.match(v) {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// cafeIndex — список кафе города вместе с названиями, заранее
+// обработанными normalizeName, чтобы не делать этого на каждый запрос.
+// Срезы выровнены: lower[i] и folded[i] получены из cafes[i].Name.
+// Дерево trie построено по lower и нужно для поиска по префиксу.
+type cafeIndex struct {
+	cafes  []Cafe
+	lower  []string // normalizeName(name, false)
+	folded []string // normalizeName(name, true)
+	trie   *prefixTrie
+}
+
+// newCafeIndex строит индекс по копии списка cafes.
+func newCafeIndex(cafes []Cafe) cafeIndex {
+	idx := cafeIndex{
+		cafes:  cloneCafes(cafes),
+		lower:  make([]string, len(cafes)),
+		folded: make([]string, len(cafes)),
+	}
+	for i, c := range cafes {
+		idx.lower[i] = normalizeName(c.Name, false)
+		idx.folded[i] = normalizeName(c.Name, true)
+	}
+	idx.trie = newPrefixTrie(idx.lower)
+	return idx
+}
+
+// withPrefix возвращает кафе индекса, названия которых
+// начинаются с prefix без учёта регистра.
+func (idx cafeIndex) withPrefix(prefix string) []string {
+	var found []string
+	for _, i := range idx.trie.withPrefix(normalizeName(prefix, false)) {
+		found = append(found, idx.cafes[i].Name)
+	}
+	return found
+}
+
+// search возвращает новый срез кафе индекса, подходящих под запрос query.
+// Сами кафе не копируются, их нельзя изменять.
+func (idx cafeIndex) search(query searchQuery) []Cafe {
+	if query.empty() {
+		return slices.Clone(idx.cafes)
+	}
+	normalized := idx.lower
+	if query.fold {
+		normalized = idx.folded
+	}
+	var found []Cafe
+	for i, name := range normalized {
+		if query.matchNormalized(name) {
+			found = append(found, idx.cafes[i])
+		}
+	}
+	return found
+}
+
+// indexedStore реализуют хранилища с готовым индексом для поиска.
+type indexedStore interface {
+	search(city string, query searchQuery) ([]Cafe, bool)
+	withPrefix(city, prefix string) ([]string, bool)
+}
+
+// findCafes возвращает кафе города city, подходящие под запрос query.
+// Если хранилище умеет искать по индексу, используется он.
+// Второе значение равно false, если города нет.
+func findCafes(store CafeStore, city string, query searchQuery) ([]Cafe, bool) {
+	if s, ok := store.(indexedStore); ok {
+		return s.search(city, query)
+	}
+	cafe, ok := store.Details(city)
+	if !ok || query.empty() {
+		return cafe, ok
+	}
+	return slices.DeleteFunc(cafe, func(c Cafe) bool { return !query.match(c.Name) }), true
+}
+
+// findByPrefix возвращает кафе города city, названия которых начинаются
+// с prefix без учёта регистра. Если хранилище умеет искать по индексу,
+// используется префиксное дерево. Второе значение равно false, если города нет.
+func findByPrefix(store CafeStore, city, prefix string) ([]string, bool) {
+	if s, ok := store.(indexedStore); ok {
+		return s.withPrefix(city, prefix)
+	}
+	cafe, ok := findCafes(store, city, searchQuery{terms: []string{normalizeName(prefix, false)}, prefix: true})
+	return cafeNames(cafe), ok
+}
+
+// levenshtein возвращает расстояние Левенштейна между a и b,
+// считая правки по рунам, а не по байтам.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevenshtein(t *testing.T) {
+	requests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"кофе", "", 4},
+		{"кофе", "кофе", 0},
+		{"кофе", "кофа", 1},
+		{"кофе", "коф", 1},
+		{"кофе", "скофе", 1},
+		{"кофе", "чай", 4},
+		{"kitten", "sitting", 3},
+	}
+	for _, v := range requests {
+		assert.Equal(t, v.want, levenshtein(v.a, v.b), "%q -> %q", v.a, v.b)
+		assert.Equal(t, v.want, levenshtein(v.b, v.a), "%q -> %q", v.b, v.a)
+	}
+}
+
+func TestCafeFuzzySearch(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&search=кофа", http.StatusOK, ""},
+		{"/cafe?city=moscow&search=кофа&fuzzy=true", http.StatusOK, "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=КОФА&fuzzy=true", http.StatusOK, "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=кофе&fuzzy=true", http.StatusOK, "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=слодкоешка&fuzzy=true", http.StatusOK, ""},
+		{"/cafe?city=moscow&search=слодкоешка&fuzzy=true&maxDistance=2", http.StatusOK, "Сладкоежка"},
+		{"/cafe?city=moscow&search=кофа&fuzzy=true&maxDistance=0", http.StatusOK, ""},
+		{"/cafe?city=moscow&search=кофа&fuzzy=true&maxDistance=-1", http.StatusBadRequest, "incorrect maxDistance"},
+		{"/cafe?city=moscow&search=кофа&fuzzy=true&maxDistance=na", http.StatusBadRequest, "incorrect maxDistance"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeSearchMultipleTerms(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&search=кофе,вилка", http.StatusOK, "Мир кофе,Кофе и завтраки,Ложка и вилка"},
+		{"/cafe?city=moscow&search=%20кофе%20,,%20вилка&match=any", http.StatusOK, "Мир кофе,Кофе и завтраки,Ложка и вилка"},
+		{"/cafe?city=moscow&search=кофе,фасоль", http.StatusOK, "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=кофе,завтрак&match=all", http.StatusOK, "Кофе и завтраки"},
+		{"/cafe?city=moscow&search=кофе,,&match=all", http.StatusOK, "Мир кофе,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=кофе,фасоль&match=all", http.StatusOK, ""},
+		{"/cafe?city=tula&search=,,", http.StatusOK, "Пир и мир,Красиво есть не запретишь,Поздний завтрак"},
+		{"/cafe?city=moscow&search=кофе&match=some", http.StatusBadRequest, "incorrect match"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafePrefixSearch(t *testing.T) {
+	handler := http.HandlerFunc(mainHandle)
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=moscow&search=ко", http.StatusOK, "Мир кофе,Сладкоежка,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=ко&mode=contains", http.StatusOK, "Мир кофе,Сладкоежка,Кофе и завтраки"},
+		{"/cafe?city=moscow&search=ко&mode=prefix", http.StatusOK, "Кофе и завтраки"},
+		{"/cafe?city=moscow&search=С&mode=prefix", http.StatusOK, "Сладкоежка,Сытый студент"},
+		{"/cafe?city=moscow&search=с&mode=prefix&count=1", http.StatusOK, "Сладкоежка"},
+		{"/cafe?city=moscow&search=кофе&mode=prefix&count=0", http.StatusOK, ""},
+		{"/cafe?city=moscow&search=ко&mode=suffix", http.StatusBadRequest, "incorrect mode"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestCafeWholeWordSearch(t *testing.T) {
+	handler := NewHandler(mockStore{"kazan": {"Антикофейня", "Мир кофе", "Кофе-брейк", "Кофейня у Кремля", "Кофе2Go", "Café Crème"}})
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"search=кофе", "Антикофейня,Мир кофе,Кофе-брейк,Кофейня у Кремля,Кофе2Go"},
+		{"search=кофе&wholeWord=false", "Антикофейня,Мир кофе,Кофе-брейк,Кофейня у Кремля,Кофе2Go"},
+		// дефис и цифра — не буквы, поэтому слово на них заканчивается
+		{"search=кофе&wholeWord=true", "Мир кофе,Кофе-брейк,Кофе2Go"},
+		{"search=КОФЕЙНЯ&wholeWord=true", "Кофейня у Кремля"},
+		{"search=кофе&wholeWord=true&mode=prefix", "Кофе-брейк,Кофе2Go"},
+		{"search=ко&wholeWord=true", ""},
+		{"search=у%20кремля&wholeWord=true", "Кофейня у Кремля"},
+		// é не отделяет «caf» от соседней буквы
+		{"search=caf&wholeWord=true", ""},
+		{"search=café&wholeWord=true", "Café Crème"},
+		{"search=cafe&wholeWord=true&fold=true", "Café Crème"},
+		{"search=кофе,анти&wholeWord=true", "Мир кофе,Кофе-брейк,Кофе2Go"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/cafe?city=kazan&"+v.request, nil))
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	requests := []struct {
+		name string
+		fold bool
+		want string
+	}{
+		{"Мир Кофе", false, "мир кофе"},
+		{"Ёлка", false, "ёлка"},
+		{"Ёлка", true, "елка"},
+		{"ёлка", false, "ёлка"},
+		{"ёлка", true, "елка"},
+		{"Café", false, "café"},
+		{"Café", false, "café"},
+		{"Café", true, "cafe"},
+		{"Чайный", true, "чайный"},
+	}
+	for _, v := range requests {
+		assert.Equal(t, v.want, normalizeName(v.name, v.fold), "%q fold=%v", v.name, v.fold)
+	}
+}
+
+func TestCafeFoldSearch(t *testing.T) {
+	handler := NewHandler(NewMemoryStore(map[string][]string{
+		"moscow": {"Café Pushkin", "Ёлки-палки", "Café Central", "Чайный дом"},
+	}))
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&search=caf%C3%A9", "Caf\u00e9 Pushkin,Cafe\u0301 Central"},
+		{"/cafe?city=moscow&search=cafe%CC%81", "Caf\u00e9 Pushkin,Cafe\u0301 Central"},
+		{"/cafe?city=moscow&search=cafe", ""},
+		{"/cafe?city=moscow&search=cafe&fold=true", "Caf\u00e9 Pushkin,Cafe\u0301 Central"},
+		{"/cafe?city=moscow&search=елки", ""},
+		{"/cafe?city=moscow&search=елки&fold=true", "Ёлки-палки"},
+		{"/cafe?city=moscow&search=ёлки&fold=true", "Ёлки-палки"},
+		{"/cafe?city=moscow&search=чаи&fold=true", ""},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.want, response.Body.String(), v.request)
+	}
+}
+
+func TestCafeIndex(t *testing.T) {
+	store := NewMemoryStore(map[string][]string{"moscow": {"Кофейня Ёлка", "Café Noir", "Чайхона"}})
+	require.NoError(t, store.Add("moscow", "Кофе Хауз"))
+	require.NoError(t, store.Delete("moscow", "чайхона"))
+
+	// индекс должен совпадать с поиском без него и после изменений
+	cafe, _ := store.Cafes("moscow")
+	for _, target := range []string{
+		"/cafe?search=кофе",
+		"/cafe?search=елка&fold=true",
+		"/cafe?search=cafe&fold=true",
+		"/cafe?search=ко&mode=prefix",
+		"/cafe?search=кафе&fuzzy=true",
+		"/cafe",
+	} {
+		query, err := parseSearch(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+		found, ok := findCafes(store, "moscow", query)
+		assert.True(t, ok)
+		assert.Equal(t, searchCafes(cafe, query), cafeNames(found), target)
+	}
+
+	idx := store.index["moscow"]
+	require.Len(t, idx.lower, len(idx.cafes))
+	require.Len(t, idx.folded, len(idx.cafes))
+	for i, c := range idx.cafes {
+		assert.Equal(t, normalizeName(c.Name, false), idx.lower[i])
+		assert.Equal(t, normalizeName(c.Name, true), idx.folded[i])
+	}
+
+	_, ok := findCafes(store, "omsk", searchQuery{})
+	assert.False(t, ok)
+}
+
+// benchCafes возвращает n названий кафе для бенчмарков.
+func benchCafes(n int) []string {
+	cafe := make([]string, n)
+	for i := range cafe {
+		cafe[i] = fmt.Sprintf("Кофейня «Ёлка» №%d", i)
+	}
+	return cafe
+}
+
+func BenchmarkSearch(b *testing.B) {
+	cafe := benchCafes(10000)
+	query := searchQuery{terms: []string{"ёлка» №99"}}
+
+	b.Run("scan", func(b *testing.B) {
+		for b.Loop() {
+			searchCafes(cafe, query)
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		idx := newCafeIndex(cafesFromNames(map[string][]string{"": cafe})[""])
+		for b.Loop() {
+			idx.search(query)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Server объединяет всё, что нужно для обслуживания API:
+// хранилище, настройки, журнал и метрики.
+type Server struct {
+	store   CafeStore
+	config  Config
+	logger  *slog.Logger
+	metrics *metrics // nil, если метрики не собираются
+	gather  http.Handler
+	limiter *rateLimiter
+	stats   *cityStats
+	cafe    http.HandlerFunc
+	random  *rand.Rand   // общий генератор /cafe/random; nil, если не задан CAFE_RANDOM_SEED
+	tracer  trace.Tracer // nil, если трассировка выключена
+}
+
+// NewServer создаёт сервер поверх store с настройками config. Журнал
+// запросов и паники пишутся в logger. Если reg не nil, в нём
+// регистрируются метрики, а маршрут /metrics отдаёт их, если reg
+// умеет их собирать, как *prometheus.Registry.
+func NewServer(store CafeStore, config Config, logger *slog.Logger, reg prometheus.Registerer) *Server {
+	s := &Server{
+		store:  store,
+		config: config,
+		logger: logger,
+		stats:  newCityStats(),
+		cafe:   newCafeHandler(store, config),
+	}
+	if reg != nil {
+		s.metrics = newMetrics(reg, store)
+		if reg == prometheus.DefaultRegisterer {
+			// вместе с метриками самого обработчика /metrics
+			s.gather = promhttp.Handler()
+		} else if g, ok := reg.(prometheus.Gatherer); ok {
+			s.gather = promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+		}
+	}
+	if config.RandomSeed != nil {
+		// то же начальное значение, что и у параметра seed
+		s.random = rand.New(&lockedSource{src: rand.NewPCG(uint64(*config.RandomSeed), 0)})
+	}
+	if config.RateLimit > 0 {
+		s.limiter = newRateLimiter(config.RateLimit, config.RateBurst)
+	}
+	return s
+}
+
+// mux регистрирует все маршруты сервиса. Маршруты API, включая /stats
+// и /openapi.json, доступны под префиксом /v1, а прежние адреса без
+// префикса оставлены как устаревшие синонимы. Служебные адреса для
+// эксплуатации — /healthz, /metrics, /debug/config и /reload — к версии
+// API не относятся и доступны только без префикса.
+func (s *Server) mux() *http.ServeMux {
+	// изменять данные и сбрасывать статистику может только администратор
+	admin := adminAuth{user: s.config.AdminUser, pass: s.config.AdminPass, keys: s.config.APIKeys}
+	var cafe http.Handler = adminHandler(countCityRequests(timeoutHandler(s.cafe, s.config.RequestTimeout), s.stats), admin)
+	cafe = bodyLimitHandler(cafe, s.config.MaxBodySize)
+	if s.tracer != nil {
+		cafe = traceHandler(cafe, s.tracer)
+	}
+	api := []struct {
+		path    string
+		handler http.Handler
+	}{
+		{`/cafe`, cafe},
+		{`/cafe/random`, newRandomHandler(s.store, s.random)},
+		{`/cafe/lookup`, NewLookupHandler(s.store)},
+		{`/cafe/count`, NewCountHandler(s.store)},
+		{`/cafe/index`, NewIndexHandler(s.store)},
+		{`/cafe/nearest`, NewNearestHandler(s.store, s.config)},
+		{`/cafe/stream`, NewStreamHandler(s.store)},
+		{`/cafe/batch`, bodyLimitHandler(newBatchHandler(controlCharsHandler(s.cafe)), s.config.MaxBodySize)},
+		{`/cities`, NewCitiesHandler(s.store)},
+		{`/autocomplete`, NewAutocompleteHandler(s.store)},
+		{`/tags`, NewTagsHandler(s.store)},
+		{`/stats`, adminHandler(NewStatsHandler(s.stats), admin)},
+		{`/openapi.json`, http.HandlerFunc(openAPIHandle)},
+	}
+
+	mux := http.NewServeMux()
+	for _, route := range api {
+		handler := gzipHandler(controlCharsHandler(route.handler))
+		mux.Handle(apiVersion+route.path, handler)
+		mux.Handle(route.path, deprecatedHandler(handler, apiVersion+route.path))
+	}
+	// остальные адреса получают 404 в том же виде, что и ошибки API
+	mux.HandleFunc(`/`, notFoundHandle)
+	mux.Handle(`/healthz`, NewHealthHandler(s.store))
+	if s.gather != nil {
+		mux.Handle(`/metrics`, s.gather)
+	}
+	// без DEBUG=1 адрес отвечает 404, как и любой неизвестный
+	if s.config.Debug {
+		mux.Handle(`/debug/config`, NewDebugConfigHandler(s.config))
+	}
+	// перечитать можно только данные из файлов, по токену
+	// или с учётными данными администратора
+	reload := admin
+	reload.token = s.config.ReloadToken
+	if store, ok := s.store.(*MemoryStore); ok && s.config.DataPaths != "" && reload.enabled() {
+		mux.Handle(`/reload`, bodyLimitHandler(NewReloadHandler(store, s.config.DataPaths, reload), s.config.MaxBodySize))
+	}
+	return mux
+}
+
+// Routes возвращает обработчик всех маршрутов сервиса вместе с журналом,
+// восстановлением после паник, ограничением частоты и CORS. Адреса
+// с косой чертой в конце перенаправляются на адреса без неё.
+func (s *Server) Routes() http.Handler {
+	handler := trailingSlashHandler(s.mux())
+	if s.metrics != nil {
+		handler = s.metrics.handler(handler)
+	}
+	handler = corsHandler(handler, s.config.CORSOrigin)
+	if s.limiter != nil {
+		handler = rateLimitHandler(handler, s.limiter)
+	}
+	handler = recoverHandler(handler, s.logger)
+	return logHandler(handler, s.logger)
+}
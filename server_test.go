@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMux возвращает маршруты сервера с настройками по умолчанию поверх store.
+func newMux(store CafeStore) *http.ServeMux {
+	return NewServer(store, DefaultConfig(), slog.Default(), nil).mux()
+}
+
+func TestServerRoutes(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.StrictParams = true
+	cfg.CORSOrigin = "*"
+	server := NewServer(NewMemoryStore(cafeList), cfg, newLogger(&buf, DefaultConfig()), prometheus.NewRegistry())
+	handler := server.Routes()
+
+	do := func(target string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", target, nil))
+		return response
+	}
+
+	response := do("/v1/cafe?city=tula&count=1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Пир и мир", response.Body.String())
+	assert.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+
+	// настройки берутся из Config, а не из окружения
+	response = do("/v1/cafe?city=tula&limit=1")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "unknown parameter: limit", strings.TrimSpace(response.Body.String()))
+
+	response = do("/metrics")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `cafe_http_requests_total{path="/v1/cafe",status="200"} 1`)
+
+	assert.Contains(t, buf.String(), `method=GET url="/v1/cafe?city=tula&count=1" status=200`)
+
+	// без реестра метрик маршрута /metrics нет
+	server = NewServer(NewMemoryStore(cafeList), DefaultConfig(), newLogger(&buf, DefaultConfig()), nil)
+	response = httptest.NewRecorder()
+	server.Routes().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestNotFound(t *testing.T) {
+	mux := newMux(defaultStore)
+
+	requests := []struct {
+		request     string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{"/unknown", "", "text/plain; charset=utf-8", "not found"},
+		{"/", "", "text/plain; charset=utf-8", "not found"},
+		{"/v1/cafes?city=moscow", "", "text/plain; charset=utf-8", "not found"},
+		{"/v2/cafe", "application/json", "application/json; charset=utf-8", `{"error":"not found"}`},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		if v.accept != "" {
+			req.Header.Set("Accept", v.accept)
+		}
+		mux.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusNotFound, response.Code, v.request)
+		assert.Equal(t, v.contentType, response.Header().Get("Content-Type"), v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
+
+func TestDebugConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StrictParams = true
+	cfg.DataPaths = "cafes.json,extra"
+	cfg.ReloadToken = "reload-secret"
+	cfg.AdminPass = "admin-secret"
+	cfg.APIKeys = []string{"key-secret"}
+	logger := slog.New(slog.DiscardHandler)
+
+	// без DEBUG=1 маршрута нет
+	response := httptest.NewRecorder()
+	NewServer(defaultStore, cfg, logger, nil).Routes().ServeHTTP(response, httptest.NewRequest("GET", "/debug/config", nil))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	cfg.Debug = true
+	response = httptest.NewRecorder()
+	NewServer(defaultStore, cfg, logger, nil).Routes().ServeHTTP(response, httptest.NewRequest("GET", "/debug/config", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"addr":":8080","maxCount":1000,"defaultCount":25,"cacheMaxAge":60,"strictParams":true,"dataSource":"cafes.json,extra"}`, response.Body.String())
+	assert.NotContains(t, response.Body.String(), "secret")
+
+	response = httptest.NewRecorder()
+	NewDebugConfigHandler(DefaultConfig()).ServeHTTP(response, httptest.NewRequest("GET", "/debug/config", nil))
+	assert.Contains(t, response.Body.String(), `"dataSource":"builtin"`)
+}
+
+func TestBodyLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxBodySize = 64
+	mux := NewServer(NewMemoryStore(cafeList), cfg, slog.New(slog.DiscardHandler), nil).mux()
+
+	long := strings.Repeat("кофе", 20)
+	requests := []struct {
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{"/v1/cafe?city=tula", `{"name":"` + long + `"}`, http.StatusRequestEntityTooLarge, "request body too large"},
+		{"/v1/cafe/batch", `[{"city":"tula","search":"` + long + `"}]`, http.StatusRequestEntityTooLarge, "request body too large"},
+		// в пределах лимита тело разбирается как обычно
+		{"/v1/cafe?city=tula", `{"name":"Дубок"}`, http.StatusCreated, ""},
+		{"/v1/cafe/batch", `[{"city":"tula","count":1}]`, http.StatusOK, `[{"city":"tula","cafes":[{"name":"Пир и мир"}]}]`},
+		{"/v1/cafe/batch", `[{"city":`, http.StatusBadRequest, "invalid body"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, httptest.NewRequest("POST", v.target, strings.NewReader(v.body)))
+
+		assert.Equal(t, v.status, response.Code, v.body)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.body)
+	}
+}
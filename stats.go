@@ -0,0 +1,77 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// cityStats считает успешные запросы /cafe по городам.
+type cityStats struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newCityStats() *cityStats {
+	return &cityStats{counts: make(map[string]int64)}
+}
+
+// add засчитывает по одному запросу каждому городу из cities.
+func (s *cityStats) add(cities []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, city := range cities {
+		s.counts[city]++
+	}
+}
+
+// snapshot возвращает копию счётчиков.
+func (s *cityStats) snapshot() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.counts)
+}
+
+func (s *cityStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.counts)
+}
+
+// countCityRequests засчитывает в stats города из параметра city
+// каждого GET-запроса к next, на который ответ был 200.
+func countCityRequests(next http.Handler, stats *cityStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+		if req.Method != http.MethodGet || (rec.status != http.StatusOK && rec.status != 0) {
+			return
+		}
+		// /cafe сообщает обработанные названия городов, в том числе
+		// уже заменённые ключами вместо других названий
+		if cities := w.Header().Get("X-Cafe-City"); cities != "" {
+			stats.add(strings.Split(cities, ","))
+		}
+	})
+}
+
+// NewStatsHandler возвращает обработчик /stats: GET отдаёт число успешных
+// запросов /cafe по городам в JSON, DELETE обнуляет счётчики.
+func NewStatsHandler(stats *cityStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, req, stats.snapshot())
+		case http.MethodDelete:
+			stats.reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, req, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
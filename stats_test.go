@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	mux := newMux(NewMemoryStore(cafeList))
+	do := func(method, target string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, httptest.NewRequest(method, target, nil))
+		return response
+	}
+
+	for _, target := range []string{
+		"/v1/cafe?city=moscow",
+		"/cafe?city=moscow&count=1",
+		"/v1/cafe?city=Tula,moscow",
+		// ошибки не засчитываются
+		"/v1/cafe?city=omsk",
+		"/v1/cafe?city=moscow&count=na",
+	} {
+		do("GET", target)
+	}
+	do("DELETE", "/v1/cafe?city=tula&name=nope")
+
+	response := do("GET", "/stats")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"moscow":3,"tula":1}`, response.Body.String())
+
+	response = do("DELETE", "/stats")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.JSONEq(t, `{}`, do("GET", "/stats").Body.String())
+
+	response = do("POST", "/stats")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+	assert.Equal(t, "GET, DELETE", response.Header().Get("Allow"))
+	assert.Equal(t, "method not allowed", strings.TrimSpace(response.Body.String()))
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	// база часовых поясов на случай, если в системе её нет
+	_ "time/tzdata"
+)
+
+var (
+	// ErrUnknownCity возвращается, если города нет в хранилище.
+	ErrUnknownCity = errors.New("unknown city")
+	// ErrCafeNotFound возвращается, если в городе нет такого кафе.
+	ErrCafeNotFound = errors.New("cafe not found")
+)
+
+// Cafe — кафе со всеми известными о нём данными.
+type Cafe struct {
+	Name string `json:"name"`
+	// Rating — оценка кафе от 0 до 5; nil, если оценки нет.
+	Rating *float64 `json:"rating,omitempty"`
+	// Hours — часы работы; nil, если они неизвестны.
+	Hours *Hours `json:"hours,omitempty"`
+	// Tags — метки кафе, например coffee или breakfast.
+	Tags []string `json:"tags,omitempty"`
+	// Featured отмечает продвигаемые кафе: без sort они идут первыми.
+	Featured bool `json:"featured,omitempty"`
+	// Location — координаты кафе; nil, если они неизвестны.
+	Location *Point `json:"location,omitempty"`
+}
+
+// HasTag сообщает, есть ли у кафе метка tag без учёта регистра.
+func (c Cafe) HasTag(tag string) bool {
+	return slices.ContainsFunc(c.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// UnmarshalJSON позволяет записывать кафе без дополнительных данных
+// просто строкой с названием.
+func (c *Cafe) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Cafe{Name: name}
+		return nil
+	}
+	// отдельный тип, чтобы не вызвать UnmarshalJSON рекурсивно
+	type plain Cafe
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// cafeNames возвращает названия кафе из cafes.
+func cafeNames(cafes []Cafe) []string {
+	names := make([]string, len(cafes))
+	for i, c := range cafes {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// cafesFromNames превращает списки названий в кафе без дополнительных данных.
+func cafesFromNames(names map[string][]string) map[string][]Cafe {
+	cafes := make(map[string][]Cafe, len(names))
+	for city, cafe := range names {
+		cafes[city] = make([]Cafe, len(cafe))
+		for i, name := range cafe {
+			cafes[city][i] = Cafe{Name: name}
+		}
+	}
+	return cafes
+}
+
+// City — кафе города вместе с его часовым поясом.
+type City struct {
+	// Timezone — часовой пояс IANA, например Europe/Moscow;
+	// пустой, если пояс не задан.
+	Timezone string `json:"timezone,omitempty"`
+	// Aliases — другие названия города в нижнем регистре,
+	// например москва для moscow.
+	Aliases []string `json:"aliases,omitempty"`
+	Cafes   []Cafe   `json:"cafes"`
+}
+
+// UnmarshalJSON позволяет записывать город без часового пояса
+// просто списком кафе.
+func (c *City) UnmarshalJSON(data []byte) error {
+	var cafes []Cafe
+	if err := json.Unmarshal(data, &cafes); err == nil {
+		*c = City{Cafes: cafes}
+		return nil
+	}
+	type plain City
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// withZones собирает города из списков кафе cafes и часовых поясов zones.
+func withZones(cafes map[string][]Cafe, zones map[string]string) map[string]City {
+	cities := make(map[string]City, len(cafes))
+	for city, cafe := range cafes {
+		cities[city] = City{Timezone: zones[city], Cafes: cafe}
+	}
+	return cities
+}
+
+// CafeStore — хранилище кафе, сгруппированных по городам.
+// Ключи городов хранятся в нижнем регистре. Города всегда
+// перечисляются по алфавиту, а кафе внутри города — в порядке
+// добавления, поэтому ответы не зависят от порядка обхода map.
+type CafeStore interface {
+	// Cities возвращает отсортированный список городов.
+	Cities() []string
+	// Cafes возвращает копию списка кафе города в порядке добавления.
+	// Второе значение равно false, если города нет.
+	Cafes(city string) ([]string, bool)
+	// Details возвращает то же, что Cafes, вместе с данными о кафе.
+	Details(city string) ([]Cafe, bool)
+	// Add добавляет кафе name в конец списка города city.
+	Add(city, name string) error
+	// Delete удаляет кафе name из города city без учёта регистра.
+	Delete(city, name string) error
+	// Location возвращает часовой пояс города; если он не задан — UTC.
+	Location(city string) (*time.Location, error)
+}
+
+// MemoryStore хранит кафе в памяти и безопасен для конкурентного доступа.
+// Для поиска оно держит индекс с обработанными названиями,
+// который пересобирается при каждом изменении города.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	cafes map[string][]Cafe
+	index map[string]cafeIndex
+	zones map[string]*time.Location // nil у городов без пояса
+	// aliases сопоставляет другие названия городов их ключам
+	aliases map[string]string
+	// rev увеличивается при каждом изменении данных
+	rev uint64
+	// modTime — время загрузки или последнего изменения данных
+	modTime time.Time
+	// warned запоминает города, о поясе которых уже предупредили
+	warned sync.Map
+	// subs — подписчики на новые кафе по городам
+	subs map[string]map[chan string]struct{}
+}
+
+// subscriberBuffer — сколько новых кафе может ждать медленный подписчик;
+// сверх этого события для него пропускаются.
+const subscriberBuffer = 16
+
+// NewMemoryStore создаёт хранилище с копией списков названий cafes.
+func NewMemoryStore(cafes map[string][]string) *MemoryStore {
+	return NewMemoryStoreFromCafes(cafesFromNames(cafes))
+}
+
+// NewMemoryStoreFromCafes создаёт хранилище с копией данных cafes
+// без часовых поясов.
+func NewMemoryStoreFromCafes(cafes map[string][]Cafe) *MemoryStore {
+	return NewMemoryStoreFromCities(withZones(cafes, nil))
+}
+
+// NewMemoryStoreFromCities создаёт хранилище с копией данных cities.
+// Неизвестные часовые пояса считаются незаданными.
+func NewMemoryStoreFromCities(cities map[string]City) *MemoryStore {
+	s := &MemoryStore{
+		cafes:   make(map[string][]Cafe, len(cities)),
+		index:   make(map[string]cafeIndex, len(cities)),
+		zones:   make(map[string]*time.Location, len(cities)),
+		aliases: make(map[string]string),
+		modTime: time.Now(),
+	}
+	for name, city := range cities {
+		for _, alias := range city.Aliases {
+			s.aliases[normalizeCity(alias)] = name
+		}
+		s.cafes[name] = cloneCafes(city.Cafes)
+		s.index[name] = newCafeIndex(city.Cafes)
+		if city.Timezone != "" {
+			s.zones[name], _ = time.LoadLocation(city.Timezone)
+		}
+	}
+	return s
+}
+
+// cloneCafes копирует список кафе вместе с данными, на которые
+// ссылаются его элементы.
+func cloneCafes(cafes []Cafe) []Cafe {
+	if cafes == nil {
+		return nil
+	}
+	clone := make([]Cafe, len(cafes))
+	for i, c := range cafes {
+		if c.Rating != nil {
+			rating := *c.Rating
+			c.Rating = &rating
+		}
+		if c.Hours != nil {
+			hours := *c.Hours
+			c.Hours = &hours
+		}
+		if c.Location != nil {
+			location := *c.Location
+			c.Location = &location
+		}
+		c.Tags = slices.Clone(c.Tags)
+		clone[i] = c
+	}
+	return clone
+}
+
+// Replace целиком заменяет данные хранилища копией списков названий cafes.
+// Запросы, начатые до замены, видят прежние данные.
+func (s *MemoryStore) Replace(cafes map[string][]string) {
+	s.ReplaceCities(withZones(cafesFromNames(cafes), nil))
+}
+
+// ReplaceCities — то же, что Replace, для городов со всеми данными.
+func (s *MemoryStore) ReplaceCities(cities map[string]City) {
+	fresh := NewMemoryStoreFromCities(cities)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cafes, s.index, s.zones, s.aliases = fresh.cafes, fresh.index, fresh.zones, fresh.aliases
+	s.rev++
+	s.modTime = fresh.modTime
+}
+
+// resolve возвращает ключ города, другим названием которого
+// является city, или сам city.
+func (s *MemoryStore) resolve(city string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name, ok := s.aliases[city]; ok {
+		return name
+	}
+	return city
+}
+
+func (s *MemoryStore) Cities() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(s.cafes))
+}
+
+func (s *MemoryStore) Cafes(city string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cafe, ok := s.cafes[city]
+	if !ok {
+		return nil, false
+	}
+	// копия нужна, чтобы вызывающий мог сортировать её без блокировки
+	return cafeNames(cafe), true
+}
+
+func (s *MemoryStore) Details(city string) ([]Cafe, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cafe, ok := s.cafes[city]
+	return cloneCafes(cafe), ok
+}
+
+func (s *MemoryStore) Add(city, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cafe, ok := s.cafes[city]
+	if !ok {
+		return ErrUnknownCity
+	}
+	s.cafes[city] = append(cafe, Cafe{Name: name})
+	s.index[city] = newCafeIndex(s.cafes[city])
+	s.rev++
+	s.modTime = time.Now()
+	for ch := range s.subs[city] {
+		// подписчик не должен задерживать добавление
+		select {
+		case ch <- name:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(city, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cafe, ok := s.cafes[city]
+	if !ok {
+		return ErrUnknownCity
+	}
+	i := slices.IndexFunc(cafe, func(c Cafe) bool {
+		return strings.EqualFold(c.Name, name)
+	})
+	if i < 0 {
+		return ErrCafeNotFound
+	}
+	s.cafes[city] = slices.Delete(cafe, i, i+1)
+	s.index[city] = newCafeIndex(s.cafes[city])
+	s.rev++
+	s.modTime = time.Now()
+	return nil
+}
+
+// Location возвращает часовой пояс города city. Если пояс не задан,
+// возвращается UTC, а в журнал один раз пишется предупреждение.
+func (s *MemoryStore) Location(city string) (*time.Location, error) {
+	s.mu.RLock()
+	_, ok := s.cafes[city]
+	loc := s.zones[city]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownCity
+	}
+	if loc == nil {
+		if _, warned := s.warned.LoadOrStore(city, true); !warned {
+			slog.Warn("city has no timezone, using UTC", "city", city)
+		}
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// subscribe возвращает текущие кафе города city и канал, в который
+// будут приходить названия добавленных после этого кафе. Функцию
+// отмены нужно вызвать, когда подписка больше не нужна. Второе
+// значение равно false, если города нет.
+func (s *MemoryStore) subscribe(city string) ([]string, <-chan string, func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cafe, ok := s.cafes[city]
+	if !ok {
+		return nil, nil, nil, false
+	}
+	ch := make(chan string, subscriberBuffer)
+	if s.subs == nil {
+		s.subs = make(map[string]map[chan string]struct{})
+	}
+	if s.subs[city] == nil {
+		s.subs[city] = make(map[chan string]struct{})
+	}
+	s.subs[city][ch] = struct{}{}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subs[city], ch)
+		if len(s.subs[city]) == 0 {
+			delete(s.subs, city)
+		}
+	}
+	return cafeNames(cafe), ch, cancel, true
+}
+
+func (s *MemoryStore) search(city string, query searchQuery) ([]Cafe, bool) {
+	s.mu.RLock()
+	idx, ok := s.index[city]
+	s.mu.RUnlock()
+
+	// индекс не меняется после построения, искать можно без блокировки
+	return idx.search(query), ok
+}
+
+func (s *MemoryStore) withPrefix(city, prefix string) ([]string, bool) {
+	s.mu.RLock()
+	idx, ok := s.index[city]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return idx.withPrefix(prefix), true
+}
+
+func (s *MemoryStore) version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rev
+}
+
+func (s *MemoryStore) lastModified() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.modTime
+}
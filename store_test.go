@@ -0,0 +1,127 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockStore — CafeStore с фиксированными данными только для чтения.
+type mockStore map[string][]string
+
+func (m mockStore) Cities() []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+func (m mockStore) Cafes(city string) ([]string, bool) {
+	cafe, ok := m[city]
+	return slices.Clone(cafe), ok
+}
+
+func (m mockStore) Details(city string) ([]Cafe, bool) {
+	cafe, ok := m[city]
+	if !ok {
+		return nil, false
+	}
+	return cafesFromNames(map[string][]string{city: cafe})[city], true
+}
+
+func (m mockStore) Location(city string) (*time.Location, error) {
+	if _, ok := m[city]; !ok {
+		return nil, ErrUnknownCity
+	}
+	return time.UTC, nil
+}
+
+func (m mockStore) Add(city, name string) error {
+	return ErrUnknownCity
+}
+
+func (m mockStore) Delete(city, name string) error {
+	return ErrUnknownCity
+}
+
+func TestNewHandlerWithMockStore(t *testing.T) {
+	handler := NewHandler(mockStore{"kazan": {"Чак-чак", "Эчпочмак", "Кофейня у Кремля"}})
+
+	requests := []struct {
+		request string
+		status  int
+		want    string
+	}{
+		{"/cafe?city=kazan", http.StatusOK, "Чак-чак,Эчпочмак,Кофейня у Кремля"},
+		{"/cafe?city=kazan&search=кофе", http.StatusOK, "Кофейня у Кремля"},
+		{"/cafe?city=moscow", http.StatusBadRequest, "unknown city"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, v.status, response.Code)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()))
+	}
+}
+
+func TestMemoryStoreCopiesData(t *testing.T) {
+	data := map[string][]string{"tula": {"Пир и мир"}}
+	store := NewMemoryStore(data)
+	data["tula"][0] = "Другое кафе"
+
+	cafe, ok := store.Cafes("tula")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Пир и мир"}, cafe)
+
+	cafe[0] = "Изменено"
+	cafe, _ = store.Cafes("tula")
+	assert.Equal(t, []string{"Пир и мир"}, cafe)
+}
+
+func TestMemoryStoreDetails(t *testing.T) {
+	rating := 4.5
+	store := NewMemoryStoreFromCafes(map[string][]Cafe{"tula": {{Name: "Пир и мир", Rating: &rating}}})
+	rating = 1
+
+	cafe, ok := store.Details("tula")
+	require.True(t, ok)
+	require.NotNil(t, cafe[0].Rating)
+	assert.Equal(t, 4.5, *cafe[0].Rating)
+
+	// изменение полученной копии не затрагивает хранилище
+	*cafe[0].Rating = 2
+	cafe, _ = store.Details("tula")
+	assert.Equal(t, 4.5, *cafe[0].Rating)
+
+	_, ok = store.Details("omsk")
+	assert.False(t, ok)
+}
+
+func TestMemoryStoreLocation(t *testing.T) {
+	store := NewMemoryStoreFromCities(map[string]City{
+		"moscow": {Timezone: "Europe/Moscow"},
+		"kazan":  {},
+	})
+
+	loc, err := store.Location("moscow")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Moscow", loc.String())
+
+	// без пояса используется UTC
+	loc, err = store.Location("kazan")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	_, err = store.Location("omsk")
+	assert.ErrorIs(t, err, ErrUnknownCity)
+
+	loc, err = defaultStore.Location("tula")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Moscow", loc.String())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// subscribableStore реализуют хранилища, которые сообщают о новых кафе.
+type subscribableStore interface {
+	subscribe(city string) ([]string, <-chan string, func(), bool)
+}
+
+// NewStreamHandler возвращает обработчик /cafe/stream: поток Server-Sent
+// Events, в котором сначала приходят все кафе города city, а затем
+// каждое добавленное. Поток открыт, пока клиент не отключится.
+func NewStreamHandler(store CafeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s, ok := store.(subscribableStore)
+		if !ok {
+			writeError(w, req, http.StatusNotImplemented, "streaming not supported")
+			return
+		}
+		city := resolveCity(store, req.FormValue("city"))
+		cafe, updates, cancel, ok := s.subscribe(city)
+		if !ok {
+			writeError(w, req, http.StatusBadRequest, "unknown city")
+			return
+		}
+		defer cancel()
+
+		rc := http.NewResponseController(w)
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		for _, name := range cafe {
+			writeEvent(w, name)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case name := <-updates:
+				writeEvent(w, name)
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeEvent записывает одно событие SSE с данными data.
+// Каждая строка data передаётся отдельным полем data:.
+func writeEvent(w io.Writer, data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	io.WriteString(w, "\n")
+}
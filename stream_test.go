@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCafeStream(t *testing.T) {
+	for _, compression := range []bool{true, false} {
+		store := NewMemoryStore(map[string][]string{"kazan": {"Чак-чак", "Эчпочмак"}})
+		srv := httptest.NewServer(newMux(store))
+		t.Cleanup(srv.Close)
+		// без DisableCompression клиент сам просит gzip и распаковывает ответ
+		client := &http.Client{Transport: &http.Transport{DisableCompression: !compression}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/v1/cafe/stream?city=kazan", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(t, compression, resp.Uncompressed)
+
+		events := bufio.NewReader(resp.Body)
+		readEvent := func() string {
+			var data []string
+			for {
+				line, err := events.ReadString('\n')
+				require.NoError(t, err)
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" {
+					return strings.Join(data, "\n")
+				}
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		assert.Equal(t, "Чак-чак", readEvent())
+		assert.Equal(t, "Эчпочмак", readEvent())
+
+		// новое кафе приходит в открытый поток
+		post, err := http.Post(srv.URL+"/v1/cafe?city=kazan", "application/json", strings.NewReader(`{"name":"Бахетле"}`))
+		require.NoError(t, err)
+		post.Body.Close()
+		assert.Equal(t, "Бахетле", readEvent())
+
+		// после отключения клиента подписка снимается
+		cancel()
+		resp.Body.Close()
+		assert.Eventually(t, func() bool {
+			store.mu.RLock()
+			defer store.mu.RUnlock()
+			return len(store.subs) == 0
+		}, time.Second, 10*time.Millisecond, "compression=%t", compression)
+	}
+}
+
+func TestCafeStreamErrors(t *testing.T) {
+	response := httptest.NewRecorder()
+	NewStreamHandler(defaultStore).ServeHTTP(response, httptest.NewRequest("GET", "/cafe/stream?city=omsk", nil))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "unknown city", strings.TrimSpace(response.Body.String()))
+
+	response = httptest.NewRecorder()
+	NewStreamHandler(mockStore{"kazan": {}}).ServeHTTP(response, httptest.NewRequest("GET", "/cafe/stream?city=kazan", nil))
+	assert.Equal(t, http.StatusNotImplemented, response.Code)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf strings.Builder
+	writeEvent(&buf, "две\nстроки")
+	assert.Equal(t, "data: две\ndata: строки\n\n", buf.String())
+}
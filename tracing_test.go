@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	server := NewServer(NewMemoryStore(cafeList), DefaultConfig(), slog.New(slog.DiscardHandler), nil)
+	server.tracer = tp.Tracer(tracerName)
+	mux := server.mux()
+
+	requests := []struct {
+		request string
+		status  int
+		size    int64
+	}{
+		{"/v1/cafe?city=moscow&search=кофе&count=2", http.StatusOK, 2},
+		{"/v1/cafe?city=moscow&count=2&offset=4", http.StatusOK, 1},
+		{"/v1/cafe?city=moscow&count=2&offset=4", http.StatusOK, 1}, // из кеша
+		{"/v1/cafe?city=omsk&count=2", http.StatusBadRequest, 0},
+	}
+	for _, v := range requests {
+		recorder.Reset()
+		req := httptest.NewRequest("GET", v.request, nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		response := httptest.NewRecorder()
+		mux.ServeHTTP(response, req)
+		require.Equal(t, v.status, response.Code, v.request)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1, v.request)
+		span := spans[0]
+		assert.Equal(t, "GET /v1/cafe", span.Name())
+		// трасса продолжается из заголовка traceparent
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+		attrs := attribute.NewSet(span.Attributes()...)
+		status, _ := attrs.Value("http.response.status_code")
+		assert.Equal(t, int64(v.status), status.AsInt64(), v.request)
+		city, _ := attrs.Value("cafe.city")
+		assert.Len(t, city.AsStringSlice(), 1, v.request)
+		count, _ := attrs.Value("cafe.count")
+		assert.Equal(t, int64(2), count.AsInt64(), v.request)
+		size, _ := attrs.Value("cafe.result_size")
+		assert.Equal(t, v.size, size.AsInt64(), v.request)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	tp, err := newTracerProvider(t.Context())
+	require.NoError(t, err)
+	assert.Nil(t, tp)
+}
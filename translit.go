@@ -0,0 +1,56 @@
+package main
+
+import "strings"
+
+// translitPairs — сочетания латинских букв и соответствующие им русские
+// буквы. Более длинные сочетания идут первыми, чтобы shch не разобралось
+// как s, h, c, h.
+var translitPairs = []struct {
+	latin    string
+	cyrillic string
+}{
+	{"shch", "щ"}, {"sch", "щ"},
+	{"zh", "ж"}, {"kh", "х"}, {"ch", "ч"}, {"sh", "ш"}, {"ts", "ц"},
+	{"yo", "ё"}, {"yu", "ю"}, {"ya", "я"}, {"ye", "е"},
+	{"a", "а"}, {"b", "б"}, {"c", "ц"}, {"d", "д"}, {"e", "е"}, {"f", "ф"},
+	{"g", "г"}, {"h", "х"}, {"i", "и"}, {"j", "й"}, {"k", "к"}, {"l", "л"},
+	{"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"q", "к"}, {"r", "р"},
+	{"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"},
+	{"z", "з"},
+}
+
+// transliterate переводит латинские буквы s в русские по распространённой
+// упрощённой транслитерации: kofe — кофе, chay — чай, shchi — щи.
+// Буква y после гласной читается как й, иначе как ы. Мягкий и твёрдый
+// знаки, а также неоднозначные сочетания вроде ts в «детский» не
+// восстанавливаются. Остальные символы, в том числе кириллица,
+// сохраняются; результат в нижнем регистре.
+func transliterate(s string) string {
+	s = strings.ToLower(s)
+	var b strings.Builder
+	var prev string
+	for s != "" {
+		next := ""
+		n := 0
+		for _, p := range translitPairs {
+			if strings.HasPrefix(s, p.latin) {
+				next, n = p.cyrillic, len(p.latin)
+				break
+			}
+		}
+		if n == 0 && s[0] == 'y' {
+			next, n = "ы", 1
+			if prev != "" && strings.Contains("аеёиоуыэюя", prev) {
+				next = "й"
+			}
+		}
+		if n == 0 {
+			r := []rune(s)[0]
+			next, n = string(r), len(string(r))
+		}
+		b.WriteString(next)
+		prev = next
+		s = s[n:]
+	}
+	return b.String()
+}
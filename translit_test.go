@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransliterate(t *testing.T) {
+	requests := []struct {
+		latin string
+		want  string
+	}{
+		{"kofe", "кофе"},
+		{"chay", "чай"},
+		{"Kofe", "кофе"},
+		{"shchi", "щи"},
+		{"zhuk", "жук"},
+		{"sytyy", "сытый"},
+		{"lozhka i vilka", "ложка и вилка"},
+		{"yolka", "ёлка"},
+		{"кофе", "кофе"},
+		{"kofe 24", "кофе 24"},
+		{"", ""},
+	}
+	for _, v := range requests {
+		assert.Equal(t, v.want, transliterate(v.latin), v.latin)
+	}
+}
+
+func TestCafeTranslitSearch(t *testing.T) {
+	store := NewMemoryStore(map[string][]string{
+		"moscow": {"Мир кофе", "Чайная ложка", "Сытый студент", "Coffee Bean"},
+	})
+	handler := NewHandler(store)
+
+	requests := []struct {
+		request string
+		want    string
+	}{
+		{"/cafe?city=moscow&search=kofe", ""},
+		{"/cafe?city=moscow&search=kofe&translit=true", "Мир кофе"},
+		{"/cafe?city=moscow&search=chay&translit=true", "Чайная ложка"},
+		{"/cafe?city=moscow&search=CHAY,sytyy&translit=true", "Чайная ложка,Сытый студент"},
+		{"/cafe?city=moscow&search=coffee", "Coffee Bean"},
+		{"/cafe?city=moscow&search=кофе&translit=true", "Мир кофе"},
+	}
+	for _, v := range requests {
+		response := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.request, nil)
+		handler.ServeHTTP(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code, v.request)
+		assert.Equal(t, v.want, strings.TrimSpace(response.Body.String()), v.request)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "slices"
+
+// trieNode — узел префиксного дерева по рунам.
+type trieNode struct {
+	children map[rune]*trieNode
+	ids      []int // номера ключей, заканчивающихся в этом узле
+}
+
+// prefixTrie находит ключи по префиксу, не перебирая их все.
+type prefixTrie struct {
+	root trieNode
+}
+
+// newPrefixTrie строит дерево по ключам keys; ключ keys[i] получает номер i.
+func newPrefixTrie(keys []string) *prefixTrie {
+	t := &prefixTrie{}
+	for i, key := range keys {
+		node := &t.root
+		for _, r := range key {
+			child, ok := node.children[r]
+			if !ok {
+				if node.children == nil {
+					node.children = make(map[rune]*trieNode)
+				}
+				child = &trieNode{}
+				node.children[r] = child
+			}
+			node = child
+		}
+		node.ids = append(node.ids, i)
+	}
+	return t
+}
+
+// withPrefix возвращает по возрастанию номера ключей, начинающихся с prefix.
+func (t *prefixTrie) withPrefix(prefix string) []int {
+	node := &t.root
+	for _, r := range prefix {
+		node = node.children[r]
+		if node == nil {
+			return nil
+		}
+	}
+	var ids []int
+	stack := []*trieNode{node}
+	for len(stack) > 0 {
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ids = append(ids, node.ids...)
+		for _, child := range node.children {
+			stack = append(stack, child)
+		}
+	}
+	// обход map не упорядочен, а ответ должен быть в порядке добавления
+	slices.Sort(ids)
+	return ids
+}
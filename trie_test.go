@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixTrie(t *testing.T) {
+	trie := newPrefixTrie([]string{"кофе", "кофейня", "чай", "ко", "кофе"})
+
+	requests := []struct {
+		prefix string
+		want   []int
+	}{
+		{"", []int{0, 1, 2, 3, 4}},
+		{"к", []int{0, 1, 3, 4}},
+		{"кофе", []int{0, 1, 4}},
+		{"кофейня", []int{1}},
+		{"кофейнях", nil},
+		{"сок", nil},
+	}
+	for _, v := range requests {
+		assert.Equal(t, v.want, trie.withPrefix(v.prefix), v.prefix)
+	}
+}
+
+func TestFindByPrefix(t *testing.T) {
+	cafe := map[string][]string{"moscow": {"Кофейня", "Чайхона", "кофе хауз", "Корж"}}
+	store := NewMemoryStore(cafe)
+
+	found, ok := findByPrefix(store, "moscow", "КОФ")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Кофейня", "кофе хауз"}, found)
+
+	// без индекса результат тот же
+	found, ok = findByPrefix(mockStore(cafe), "moscow", "КОФ")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Кофейня", "кофе хауз"}, found)
+
+	_, ok = findByPrefix(store, "omsk", "ко")
+	assert.False(t, ok)
+}
+
+func BenchmarkPrefix(b *testing.B) {
+	cafe := benchCafes(5000)
+	const prefix = "кофейня «ёлка» №42"
+
+	b.Run("scan", func(b *testing.B) {
+		query := searchQuery{terms: []string{prefix}, prefix: true}
+		for b.Loop() {
+			searchCafes(cafe, query)
+		}
+	})
+	b.Run("trie", func(b *testing.B) {
+		idx := newCafeIndex(cafesFromNames(map[string][]string{"": cafe})[""])
+		for b.Loop() {
+			idx.withPrefix(prefix)
+		}
+	})
+}